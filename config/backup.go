@@ -0,0 +1,176 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopher-mock/model"
+)
+
+// MaxBackups is the number of backups kept per config path. Older ones are
+// deleted when a new backup is taken; 0 disables backups.
+var MaxBackups = 10
+
+// ErrBackupNotFound is returned for unknown backup ids
+var ErrBackupNotFound = errors.New("backup not found")
+
+const backupTimeLayout = "20060102T150405.000000Z"
+
+// Backup describes a saved copy of the configs
+type Backup struct {
+	ID    string    `json:"id"`
+	Time  time.Time `json:"time"`
+	Size  int64     `json:"size"`
+	Mocks int       `json:"mocks"`
+}
+
+// backupDir is .backups next to a config file, or inside a config directory
+func backupDir(path string) string {
+	if IsDir(path) {
+		return filepath.Join(path, ".backups")
+	}
+	return filepath.Join(filepath.Dir(path), ".backups")
+}
+
+// backupPrefix names the backups of a path, e.g. "configs-" for configs.json
+func backupPrefix(path string) string {
+	base := filepath.Base(filepath.Clean(path))
+	return strings.TrimSuffix(base, filepath.Ext(base)) + "-"
+}
+
+// backup copies the current configs at path before they are overwritten with
+// next, unless nothing changes. A config file is copied as is, keeping its
+// format and comments; a directory is snapshot as one JSON file.
+func backup(path string, next []byte) error {
+	if MaxBackups <= 0 {
+		return nil
+	}
+
+	var current []byte
+	ext := filepath.Ext(path)
+	if IsDir(path) {
+		configs, err := loadDir(path)
+		if err != nil || len(configs) == 0 {
+			return nil
+		}
+		if current, err = encode(configs, false, nil); err != nil {
+			return err
+		}
+		ext = ".json"
+	} else {
+		var err error
+		if current, err = os.ReadFile(path); err != nil {
+			return nil // nothing to back up yet
+		}
+	}
+	if bytes.Equal(current, next) {
+		return nil
+	}
+
+	dir := backupDir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := backupPrefix(path) + time.Now().UTC().Format(backupTimeLayout) + ext
+	for i := 2; fileExists(filepath.Join(dir, name)); i++ {
+		name = fmt.Sprintf("%s%s-%d%s", backupPrefix(path), time.Now().UTC().Format(backupTimeLayout), i, ext)
+	}
+	if err := writeFileAtomic(filepath.Join(dir, name), current, 0644); err != nil {
+		return err
+	}
+	return pruneBackups(path)
+}
+
+// pruneBackups deletes all but the newest MaxBackups backups
+func pruneBackups(path string) error {
+	names, err := backupNames(path)
+	if err != nil {
+		return err
+	}
+	for len(names) > MaxBackups {
+		if err := os.Remove(filepath.Join(backupDir(path), names[0])); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// backupNames lists the backup files of a path, oldest first
+func backupNames(path string) ([]string, error) {
+	entries, err := os.ReadDir(backupDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix := backupPrefix(path)
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasPrefix(e.Name(), prefix) && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ListBackups lists the backups of the configs at path, newest first
+func ListBackups(path string) ([]Backup, error) {
+	names, err := backupNames(path)
+	if err != nil {
+		return nil, err
+	}
+	backups := make([]Backup, 0, len(names))
+	for i := len(names) - 1; i >= 0; i-- {
+		name := names[i]
+		info, err := os.Stat(filepath.Join(backupDir(path), name))
+		if err != nil {
+			continue
+		}
+		b := Backup{ID: name, Size: info.Size(), Time: info.ModTime().UTC()}
+		stamp := strings.TrimPrefix(strings.TrimSuffix(name, filepath.Ext(name)), backupPrefix(path))
+		if len(stamp) >= len(backupTimeLayout) {
+			if t, err := time.Parse(backupTimeLayout, stamp[:len(backupTimeLayout)]); err == nil {
+				b.Time = t
+			}
+		}
+		if configs, err := LoadBackup(path, name); err == nil {
+			b.Mocks = len(configs)
+		}
+		backups = append(backups, b)
+	}
+	return backups, nil
+}
+
+// LoadBackup reads the configs saved in a backup
+func LoadBackup(path, id string) ([]model.MockConfig, error) {
+	if id == "" || id != filepath.Base(id) || !strings.HasPrefix(id, backupPrefix(path)) {
+		return nil, fmt.Errorf("invalid backup id %q", id)
+	}
+	data, err := os.ReadFile(filepath.Join(backupDir(path), id))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrBackupNotFound, id)
+		}
+		return nil, err
+	}
+	var configs []model.MockConfig
+	if err := decode(data, isYAML(id), &configs); err != nil {
+		return nil, fmt.Errorf("backup %q: %w", id, err)
+	}
+	EnsureIDs(configs)
+	return configs, nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
@@ -1,30 +1,70 @@
 package config
 
 import (
-	"encoding/json"
+	"fmt"
 	"os"
 
 	"gopher-mock/model"
 )
 
-// LoadConfigs ...
+// LoadConfigs reads the configs from a JSON or YAML file, chosen by the
+// file extension, or from a directory with one file per mock when the path
+// has no extension (see IsDir). Mocks without an ID get one.
 func LoadConfigs(path string) ([]model.MockConfig, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
 	var configs []model.MockConfig
-	if err := json.Unmarshal(data, &configs); err != nil {
-		return nil, err
+	if IsDir(path) {
+		var err error
+		if configs, err = loadDir(path); err != nil {
+			return nil, err
+		}
+	} else {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := decode(data, isYAML(path), &configs); err != nil {
+			return nil, err
+		}
 	}
+	EnsureIDs(configs)
 	return configs, nil
 }
 
-// SaveConfigs ...
+// SaveConfigs writes the configs in the layout LoadConfigs reads. Files are
+// replaced atomically and the previous configs are backed up first (see
+// MaxBackups).
 func SaveConfigs(path string, configs []model.MockConfig) error {
-	data, err := json.MarshalIndent(configs, "", "  ")
+	if IsDir(path) {
+		snapshot, err := encode(configs, false, nil)
+		if err != nil {
+			return err
+		}
+		if err := backup(path, snapshot); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+		return saveDir(path, configs)
+	}
+
+	previous, _ := os.ReadFile(path)
+	data, err := encode(configs, isYAML(path), previous)
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(path, data, 0644)
+	if err := backup(path, data); err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// RestoreBackup saves the configs of a backup at path and returns them. The
+// configs it replaces are backed up in turn, so a restore can be undone.
+func RestoreBackup(path, id string) ([]model.MockConfig, error) {
+	configs, err := LoadBackup(path, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := SaveConfigs(path, configs); err != nil {
+		return nil, err
+	}
+	return configs, nil
 }
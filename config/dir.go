@@ -0,0 +1,241 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopher-mock/model"
+)
+
+// orderFile lists the mock files of a config directory in match order, so
+// that adding a mock changes a single line instead of renaming files
+const orderFile = ".order.json"
+
+var slugRegex = regexp.MustCompile(`[^a-z0-9]+`)
+
+// IsDir reports whether configs at path are stored one file per mock: the
+// path is an existing directory or has no file extension, e.g. "mocks/"
+func IsDir(p string) bool {
+	if info, err := os.Stat(p); err == nil {
+		return info.IsDir()
+	}
+	return filepath.Ext(p) == ""
+}
+
+// loadDir reads every mock file below dir. A mock's Folder is the directory
+// it lives in, relative to dir. Files are ordered by the order file; files
+// missing from it, e.g. added by hand, follow in path order.
+func loadDir(dir string) ([]model.MockConfig, error) {
+	files, err := mockFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var order []string
+	if data, err := os.ReadFile(filepath.Join(dir, orderFile)); err == nil {
+		if err := json.Unmarshal(data, &order); err != nil {
+			return nil, fmt.Errorf("%s: %w", orderFile, err)
+		}
+	}
+	rank := make(map[string]int, len(order))
+	for i, name := range order {
+		rank[name] = i
+	}
+	sort.SliceStable(files, func(i, j int) bool {
+		ri, okI := rank[files[i]]
+		rj, okJ := rank[files[j]]
+		if okI && okJ {
+			return ri < rj
+		}
+		if okI != okJ {
+			return okI
+		}
+		return files[i] < files[j]
+	})
+
+	configs := make([]model.MockConfig, 0, len(files))
+	for _, name := range files {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, err
+		}
+		var cfg model.MockConfig
+		if err := decode(data, isYAML(name), &cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+		if folder := path.Dir(name); folder != "." {
+			cfg.Folder = folder
+		} else {
+			cfg.Folder = ""
+		}
+		configs = append(configs, cfg)
+	}
+	return configs, nil
+}
+
+// saveDir writes each mock to <folder>/<name>.json below dir. A mock whose
+// file exists as YAML stays YAML, and new mocks follow the format most files
+// already use. Unchanged files are left alone and files of removed mocks are
+// deleted, so a save only touches what changed.
+func saveDir(dir string, configs []model.MockConfig) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	existing, err := mockFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	// Existing files by name without extension
+	extensions := make(map[string]string, len(existing))
+	yamlFiles := 0
+	for _, name := range existing {
+		ext := path.Ext(name)
+		extensions[strings.TrimSuffix(name, ext)] = ext
+		if isYAML(name) {
+			yamlFiles++
+		}
+	}
+	defaultExt := ".json"
+	if yamlFiles*2 > len(existing) {
+		defaultExt = ".yaml"
+	}
+
+	used := make(map[string]bool, len(configs))
+	order := make([]string, 0, len(configs))
+	for _, cfg := range configs {
+		stem := uniqueName(mockFileName(cfg), used)
+		used[stem] = true
+		ext, ok := extensions[stem]
+		if !ok {
+			ext = defaultExt
+		}
+		name := stem + ext
+		order = append(order, name)
+
+		// The folder is implied by the file's location
+		cfg.Folder = ""
+		file := filepath.Join(dir, filepath.FromSlash(name))
+		previous, _ := os.ReadFile(file)
+		data, err := encode(cfg, isYAML(name), previous)
+		if err != nil {
+			return err
+		}
+		if err := writeIfChanged(file, data); err != nil {
+			return err
+		}
+	}
+
+	for _, name := range existing {
+		if used[strings.TrimSuffix(name, path.Ext(name))] {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			return err
+		}
+		removeEmptyDirs(dir, path.Dir(name))
+	}
+
+	data, err := json.MarshalIndent(order, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeIfChanged(filepath.Join(dir, orderFile), append(data, '\n'))
+}
+
+// mockFiles lists the mock files below dir as slash-separated relative paths.
+// Hidden files and directories are skipped.
+func mockFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == dir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() || (filepath.Ext(p) != ".json" && !isYAML(p)) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	return files, err
+}
+
+// mockFileName derives a file name without extension like "users/get-user"
+// from the mock's folder and name, falling back to its method and path
+func mockFileName(cfg model.MockConfig) string {
+	base := slugify(cfg.Name)
+	if base == "" {
+		base = slugify(cfg.Method + " " + cfg.Path)
+	}
+	if base == "" {
+		base = "mock"
+	}
+
+	var folder []string
+	for _, part := range strings.Split(cfg.Folder, "/") {
+		part = strings.TrimSpace(part)
+		if part == "" || part == "." || part == ".." || strings.HasPrefix(part, ".") {
+			continue
+		}
+		folder = append(folder, part)
+	}
+	return path.Join(append(folder, base)...)
+}
+
+func slugify(s string) string {
+	return strings.Trim(slugRegex.ReplaceAllString(strings.ToLower(s), "-"), "-")
+}
+
+// uniqueName appends -2, -3, ... when mocks share a file name
+func uniqueName(name string, used map[string]bool) string {
+	if !used[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s-%d", name, i)
+		if !used[candidate] {
+			return candidate
+		}
+	}
+}
+
+func writeIfChanged(p string, data []byte) error {
+	if current, err := os.ReadFile(p); err == nil && bytes.Equal(current, data) {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	return writeFileAtomic(p, data, 0644)
+}
+
+// removeEmptyDirs removes folder and its parents below dir while they are empty
+func removeEmptyDirs(dir, folder string) {
+	for folder != "." && folder != "/" && folder != "" {
+		if os.Remove(filepath.Join(dir, filepath.FromSlash(folder))) != nil {
+			return
+		}
+		folder = path.Dir(folder)
+	}
+}
@@ -0,0 +1,54 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Fingerprint hashes the config file, or every mock file and the order file
+// of a config directory, so callers can tell when configs change on disk.
+// Contents are hashed rather than modification times, which tools like git
+// do not reliably update.
+func Fingerprint(path string) (string, error) {
+	h := sha256.New()
+	if !IsDir(path) {
+		if err := hashFile(h, path); err != nil {
+			return "", err
+		}
+		return hex.EncodeToString(h.Sum(nil)), nil
+	}
+
+	files, err := mockFiles(path)
+	if err != nil {
+		return "", err
+	}
+	for _, name := range append(files, orderFile) {
+		io.WriteString(h, name+"\x00")
+		if err := hashFile(h, filepath.Join(path, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ETag is a strong HTTP entity tag for the JSON form of v, a set of configs
+// or a single mock. It changes whenever the value does.
+func ETag(v interface{}) string {
+	data, _ := json.Marshal(v)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:8]) + `"`
+}
@@ -0,0 +1,380 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopher-mock/model"
+)
+
+// MaxRevisions is the number of revisions kept in the history
+var MaxRevisions = 100
+
+// ErrRevisionNotFound is returned for unknown revision ids
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision records one change to the configs: who made it, which mocks it
+// touched and the configs before and after
+type Revision struct {
+	ID      int                `json:"id"`
+	Time    time.Time          `json:"time"`
+	Author  string             `json:"author"`
+	Action  string             `json:"action"` // save, delete, bulk-delete, import, revert, ...
+	Changes []MockChange       `json:"changes"`
+	Before  []model.MockConfig `json:"before,omitempty"`
+	After   []model.MockConfig `json:"after,omitempty"`
+}
+
+// MockChange is what a revision did to one mock
+type MockChange struct {
+	Key    string            `json:"key"` // see MockKey
+	Name   string            `json:"name"`
+	Type   string            `json:"type"` // added, removed or modified
+	Fields []FieldChange     `json:"fields,omitempty"`
+	Before *model.MockConfig `json:"before,omitempty"`
+	After  *model.MockConfig `json:"after,omitempty"`
+}
+
+// FieldChange is a changed value within a mock, e.g. at
+// "responses[0].response.statusCode". A nil side means the value is absent.
+type FieldChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// historyDir is .history next to a config file, or inside a config directory
+func historyDir(path string) string {
+	if IsDir(path) {
+		return filepath.Join(path, ".history")
+	}
+	return filepath.Join(filepath.Dir(path), ".history")
+}
+
+// MockKey identifies a mock across revisions by its ID, or by its method and
+// path for mocks recorded before they had IDs
+func MockKey(cfg model.MockConfig) string {
+	if cfg.ID != "" {
+		return cfg.ID
+	}
+	return cfg.Method + " " + cfg.Path
+}
+
+// keyed indexes configs by MockKey. Later mocks with the same key get a
+// "#2", "#3", ... suffix.
+func keyed(configs []model.MockConfig) ([]string, map[string]model.MockConfig) {
+	keys := make([]string, len(configs))
+	byKey := make(map[string]model.MockConfig, len(configs))
+	for i, cfg := range configs {
+		key := MockKey(cfg)
+		for n := 2; ; n++ {
+			if _, taken := byKey[key]; !taken {
+				break
+			}
+			key = fmt.Sprintf("%s #%d", MockKey(cfg), n)
+		}
+		keys[i] = key
+		byKey[key] = cfg
+	}
+	return keys, byKey
+}
+
+// DiffConfigs lists the mocks added, removed or modified between two sets of
+// configs, in the order they appear
+func DiffConfigs(before, after []model.MockConfig) []MockChange {
+	beforeKeys, beforeByKey := keyed(before)
+	afterKeys, afterByKey := keyed(after)
+
+	var changes []MockChange
+	for _, key := range afterKeys {
+		cfg := afterByKey[key]
+		old, existed := beforeByKey[key]
+		if !existed {
+			changes = append(changes, MockChange{Key: key, Name: cfg.Name, Type: "added", After: &cfg})
+			continue
+		}
+		if fields := diffValues("", toGeneric(old), toGeneric(cfg), nil); len(fields) > 0 {
+			changes = append(changes, MockChange{Key: key, Name: cfg.Name, Type: "modified", Fields: fields, Before: &old, After: &cfg})
+		}
+	}
+	for _, key := range beforeKeys {
+		if _, kept := afterByKey[key]; !kept {
+			cfg := beforeByKey[key]
+			changes = append(changes, MockChange{Key: key, Name: cfg.Name, Type: "removed", Before: &cfg})
+		}
+	}
+	return changes
+}
+
+// toGeneric converts a mock to the maps and slices its JSON decodes to
+func toGeneric(cfg model.MockConfig) interface{} {
+	data, _ := json.Marshal(cfg)
+	var v interface{}
+	_ = json.Unmarshal(data, &v)
+	return v
+}
+
+// diffValues appends the leaf differences between a and b under path
+func diffValues(path string, a, b interface{}, out []FieldChange) []FieldChange {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		bv, ok := b.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(av)+len(bv))
+		for k := range av {
+			keys = append(keys, k)
+		}
+		for k := range bv {
+			if _, ok := av[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			child := k
+			if path != "" {
+				child = path + "." + k
+			}
+			out = diffValues(child, av[k], bv[k], out)
+		}
+		return out
+	case []interface{}:
+		bv, ok := b.([]interface{})
+		if !ok {
+			break
+		}
+		for i := 0; i < len(av) || i < len(bv); i++ {
+			var x, y interface{}
+			if i < len(av) {
+				x = av[i]
+			}
+			if i < len(bv) {
+				y = bv[i]
+			}
+			out = diffValues(path+"["+strconv.Itoa(i)+"]", x, y, out)
+		}
+		return out
+	}
+	if !reflect.DeepEqual(a, b) {
+		out = append(out, FieldChange{Path: path, Before: a, After: b})
+	}
+	return out
+}
+
+// RecordRevision stores the change from before to after in the history. It
+// returns nil when nothing changed.
+func RecordRevision(path, author, action string, before, after []model.MockConfig) (*Revision, error) {
+	changes := DiffConfigs(before, after)
+	if len(changes) == 0 || MaxRevisions <= 0 {
+		return nil, nil
+	}
+
+	ids, err := revisionIDs(path)
+	if err != nil {
+		return nil, err
+	}
+	rev := &Revision{
+		ID:      1,
+		Time:    time.Now().UTC(),
+		Author:  author,
+		Action:  action,
+		Changes: changes,
+		Before:  before,
+		After:   after,
+	}
+	if len(ids) > 0 {
+		rev.ID = ids[len(ids)-1] + 1
+	}
+
+	dir := historyDir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	data, err := encode(rev, false, nil)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, revisionFile(rev.ID)), data, 0644); err != nil {
+		return nil, err
+	}
+	if data, err = encode(summarize(*rev), false, nil); err != nil {
+		return nil, err
+	}
+	if err := writeFileAtomic(filepath.Join(dir, summaryFile(rev.ID)), data, 0644); err != nil {
+		return nil, err
+	}
+
+	// Drop the oldest revisions
+	ids = append(ids, rev.ID)
+	for len(ids) > MaxRevisions {
+		if err := os.Remove(filepath.Join(dir, revisionFile(ids[0]))); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(filepath.Join(dir, summaryFile(ids[0]))); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		ids = ids[1:]
+	}
+	return rev, nil
+}
+
+// summarize drops the config snapshots from a revision, keeping what the
+// history list shows
+func summarize(rev Revision) Revision {
+	rev.Before, rev.After = nil, nil
+	changes := make([]MockChange, len(rev.Changes))
+	for i, change := range rev.Changes {
+		change.Before, change.After = nil, nil
+		changes[i] = change
+	}
+	rev.Changes = changes
+	return rev
+}
+
+func revisionFile(id int) string {
+	return fmt.Sprintf("%06d.json", id)
+}
+
+// summaryFile holds a revision without its snapshots, so listing the history
+// does not read every snapshot
+func summaryFile(id int) string {
+	return fmt.Sprintf("%06d.summary.json", id)
+}
+
+// revisionIDs lists the stored revision ids in ascending order
+func revisionIDs(path string) ([]int, error) {
+	entries, err := os.ReadDir(historyDir(path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ids []int
+	for _, e := range entries {
+		if id, err := strconv.Atoi(strings.TrimSuffix(e.Name(), ".json")); err == nil && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids, nil
+}
+
+// LoadRevision reads a revision with its snapshots
+func LoadRevision(path string, id int) (*Revision, error) {
+	data, err := os.ReadFile(filepath.Join(historyDir(path), revisionFile(id)))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %d", ErrRevisionNotFound, id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rev Revision
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return nil, fmt.Errorf("revision %d: %w", id, err)
+	}
+	return &rev, nil
+}
+
+// ListRevisions returns the history newest first, without the config
+// snapshots, which LoadRevision provides
+func ListRevisions(path string) ([]Revision, error) {
+	ids, err := revisionIDs(path)
+	if err != nil {
+		return nil, err
+	}
+	revisions := make([]Revision, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		rev, err := loadSummary(path, ids[i])
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, *rev)
+	}
+	return revisions, nil
+}
+
+// loadSummary reads the summary of a revision. Revisions recorded before
+// summaries existed are read in full and summarized.
+func loadSummary(path string, id int) (*Revision, error) {
+	data, err := os.ReadFile(filepath.Join(historyDir(path), summaryFile(id)))
+	if os.IsNotExist(err) {
+		rev, err := LoadRevision(path, id)
+		if err != nil {
+			return nil, err
+		}
+		summary := summarize(*rev)
+		return &summary, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var rev Revision
+	if err := json.Unmarshal(data, &rev); err != nil {
+		return nil, fmt.Errorf("revision %d: %w", id, err)
+	}
+	return &rev, nil
+}
+
+// RevertRevision undoes a revision. With an empty key the whole set goes
+// back to the configs before the revision; otherwise only the change to that
+// mock is undone in current: an added mock is removed, a removed one comes
+// back at its old position and a modified one gets its previous config.
+func RevertRevision(rev *Revision, current []model.MockConfig, key string) ([]model.MockConfig, error) {
+	if key == "" {
+		result := append([]model.MockConfig{}, rev.Before...)
+		EnsureIDs(result)
+		return result, nil
+	}
+
+	var change *MockChange
+	for i := range rev.Changes {
+		if rev.Changes[i].Key == key {
+			change = &rev.Changes[i]
+			break
+		}
+	}
+	if change == nil {
+		return nil, fmt.Errorf("revision %d did not change mock %q", rev.ID, key)
+	}
+
+	keys, _ := keyed(current)
+	index := -1
+	for i, k := range keys {
+		if k == key {
+			index = i
+			break
+		}
+	}
+
+	result := append([]model.MockConfig{}, current...)
+	switch {
+	case change.Before == nil: // added
+		if index >= 0 {
+			result = append(result[:index], result[index+1:]...)
+		}
+	case index >= 0: // modified, or removed and added again since
+		result[index] = *change.Before
+	default: // removed
+		position := len(result)
+		beforeKeys, _ := keyed(rev.Before)
+		for i, k := range beforeKeys {
+			if k == key && i < position {
+				position = i
+			}
+		}
+		result = append(result[:position], append([]model.MockConfig{*change.Before}, result[position:]...)...)
+	}
+	EnsureIDs(result)
+	return result, nil
+}
@@ -0,0 +1,42 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"gopher-mock/model"
+)
+
+// EnsureIDs gives every mock without an ID, or with an ID an earlier mock
+// already uses, a new one. New IDs are derived from the method, path and
+// name, so a legacy file gets the same IDs each time it is loaded until it
+// is saved with them. It reports whether any ID was assigned.
+func EnsureIDs(configs []model.MockConfig) bool {
+	used := make(map[string]bool, len(configs))
+	for _, cfg := range configs {
+		if cfg.ID != "" {
+			used[cfg.ID] = false
+		}
+	}
+
+	assigned := false
+	for i := range configs {
+		cfg := &configs[i]
+		if cfg.ID != "" && !used[cfg.ID] {
+			used[cfg.ID] = true
+			continue
+		}
+		for n := 0; ; n++ {
+			sum := sha256.Sum256([]byte(fmt.Sprintf("%s %s\x00%s\x00%d", cfg.Method, cfg.Path, cfg.Name, n)))
+			id := hex.EncodeToString(sum[:6])
+			if _, taken := used[id]; !taken {
+				cfg.ID = id
+				used[id] = true
+				break
+			}
+		}
+		assigned = true
+	}
+	return assigned
+}
@@ -0,0 +1,80 @@
+package config
+
+import (
+	"reflect"
+
+	"gopher-mock/model"
+)
+
+// MergeConfigs applies the changes made from base to ours on top of theirs,
+// another version derived from base, one mock at a time. Mocks changed on
+// both sides conflict unless they ended up the same; their keys (see MockKey)
+// are returned instead of a result. Mocks added in ours are placed after the
+// mock preceding them there; reordering in ours is not carried over.
+func MergeConfigs(base, ours, theirs []model.MockConfig) ([]model.MockConfig, []string) {
+	theirChanges := make(map[string]MockChange)
+	for _, change := range DiffConfigs(base, theirs) {
+		theirChanges[change.Key] = change
+	}
+
+	var apply []MockChange
+	var conflicts []string
+	for _, change := range DiffConfigs(base, ours) {
+		their, both := theirChanges[change.Key]
+		switch {
+		case !both:
+			apply = append(apply, change)
+		case !sameOutcome(change, their):
+			conflicts = append(conflicts, change.Key)
+		}
+	}
+	if len(conflicts) > 0 {
+		return nil, conflicts
+	}
+
+	ourKeys, _ := keyed(ours)
+	result := append([]model.MockConfig{}, theirs...)
+	for _, change := range apply {
+		keys, _ := keyed(result)
+		index := indexOfKey(keys, change.Key)
+		switch change.Type {
+		case "removed":
+			if index >= 0 {
+				result = append(result[:index], result[index+1:]...)
+			}
+		case "modified":
+			if index >= 0 {
+				result[index] = *change.After
+				continue
+			}
+			result = append(result, *change.After)
+		case "added":
+			position := 0
+			for i := indexOfKey(ourKeys, change.Key) - 1; i >= 0; i-- {
+				if j := indexOfKey(keys, ourKeys[i]); j >= 0 {
+					position = j + 1
+					break
+				}
+			}
+			result = append(result[:position], append([]model.MockConfig{*change.After}, result[position:]...)...)
+		}
+	}
+	return result, nil
+}
+
+// sameOutcome reports whether two changes to a mock leave it in the same state
+func sameOutcome(a, b MockChange) bool {
+	if a.After == nil || b.After == nil {
+		return a.After == nil && b.After == nil
+	}
+	return reflect.DeepEqual(toGeneric(*a.After), toGeneric(*b.After))
+}
+
+func indexOfKey(keys []string, key string) int {
+	for i, k := range keys {
+		if k == key {
+			return i
+		}
+	}
+	return -1
+}
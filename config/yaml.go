@@ -0,0 +1,165 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// isYAML reports whether a config file is YAML, judging by its extension
+func isYAML(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".yaml" || ext == ".yml"
+}
+
+// decode reads JSON or YAML into v. YAML is converted to JSON first, so the
+// model's json tags apply to both formats.
+func decode(data []byte, yamlFormat bool, v interface{}) error {
+	if yamlFormat {
+		var raw interface{}
+		if err := yaml.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		var err error
+		if data, err = json.Marshal(raw); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// encode writes v as indented JSON or as YAML. For YAML the previous file
+// contents are merged in, so comments and the key order of hand-edited files
+// survive a save.
+func encode(v interface{}, yamlFormat bool, previous []byte) ([]byte, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil || !yamlFormat {
+		return append(data, '\n'), err
+	}
+
+	// JSON is YAML, so this yields the document in json tag order
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	blockStyle(&doc)
+
+	var old yaml.Node
+	if len(previous) > 0 && yaml.Unmarshal(previous, &old) == nil && len(old.Content) > 0 && len(doc.Content) > 0 {
+		doc.HeadComment, doc.FootComment = old.HeadComment, old.FootComment
+		doc.Content[0] = mergeNode(old.Content[0], doc.Content[0])
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, err
+	}
+	if err := enc.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// blockStyle drops the flow and quoting styles JSON input comes with; the
+// encoder quotes strings where YAML needs it
+func blockStyle(n *yaml.Node) {
+	n.Style = 0
+	for _, child := range n.Content {
+		blockStyle(child)
+	}
+}
+
+// mergeNode returns updated with the comments, key order and scalar styles
+// of old wherever the two still line up
+func mergeNode(old, updated *yaml.Node) *yaml.Node {
+	if old.Kind != updated.Kind {
+		copyComments(old, updated)
+		return updated
+	}
+
+	switch updated.Kind {
+	case yaml.ScalarNode:
+		if old.Value == updated.Value && old.Tag == updated.Tag {
+			return old
+		}
+		copyComments(old, updated)
+		return updated
+
+	case yaml.MappingNode:
+		values := make(map[string]*yaml.Node, len(updated.Content)/2)
+		keys := make(map[string]*yaml.Node, len(updated.Content)/2)
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			keys[updated.Content[i].Value] = updated.Content[i]
+			values[updated.Content[i].Value] = updated.Content[i+1]
+		}
+
+		// Keys keep their old position; new keys follow in their own order
+		content := make([]*yaml.Node, 0, len(updated.Content))
+		seen := make(map[string]bool, len(values))
+		for i := 0; i+1 < len(old.Content); i += 2 {
+			key := old.Content[i].Value
+			value, ok := values[key]
+			if !ok {
+				continue
+			}
+			seen[key] = true
+			content = append(content, old.Content[i], mergeNode(old.Content[i+1], value))
+		}
+		for i := 0; i+1 < len(updated.Content); i += 2 {
+			if key := updated.Content[i].Value; !seen[key] {
+				content = append(content, keys[key], values[key])
+			}
+		}
+		updated.Content = content
+
+	case yaml.SequenceNode:
+		// Elements are paired by identity (a mock's method, path and name)
+		// when they have one, so removing an item does not shift comments
+		byID := make(map[string]*yaml.Node)
+		for _, child := range old.Content {
+			if id := nodeIdentity(child); id != "" {
+				byID[id] = child
+			}
+		}
+		for i, child := range updated.Content {
+			if id := nodeIdentity(child); id != "" {
+				if match, ok := byID[id]; ok {
+					updated.Content[i] = mergeNode(match, child)
+				}
+			} else if i < len(old.Content) {
+				updated.Content[i] = mergeNode(old.Content[i], child)
+			}
+		}
+	}
+
+	copyComments(old, updated)
+	updated.Style = old.Style
+	return updated
+}
+
+func copyComments(from, to *yaml.Node) {
+	to.HeadComment, to.LineComment, to.FootComment = from.HeadComment, from.LineComment, from.FootComment
+}
+
+// nodeIdentity identifies mapping elements of a sequence by their method,
+// path and name fields
+func nodeIdentity(n *yaml.Node) string {
+	if n.Kind != yaml.MappingNode {
+		return ""
+	}
+	var parts []string
+	for i := 0; i+1 < len(n.Content); i += 2 {
+		switch n.Content[i].Value {
+		case "method", "path", "name":
+			parts = append(parts, n.Content[i].Value+"="+n.Content[i+1].Value)
+		}
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, "|")
+}
@@ -0,0 +1,428 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"gopher-mock/config"
+	"gopher-mock/model"
+)
+
+// The JSON admin API is mounted under /__admin/api/v1. Every write goes
+// through the same validation, saving and history as the editor, and every
+// error is answered with {"error": "..."}. Reads return an ETag, of the whole
+// set for /mocks and of the mock for /mocks/:id, which writes must send back in
+// If-Match to fail with 409 instead of overwriting changes made since, or "*"
+// to write regardless. Writes without If-Match fail with 428.
+
+// BulkRequest creates, updates and deletes mocks in one change
+type BulkRequest struct {
+	Create []model.MockConfig `json:"create"`
+	Update []model.MockConfig `json:"update"` // matched by id
+	Delete []string           `json:"delete"`
+}
+
+// APIListMocks lists the mocks, optionally only those matching ?method=,
+// ?path= and ?folder=
+func (h *MockHandler) APIListMocks(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	method := strings.ToUpper(c.Query("method"))
+	path := c.Query("path")
+	folder := c.Query("folder")
+	mocks := make([]model.MockConfig, 0, len(h.Configs))
+	for _, cfg := range h.Configs {
+		if (method == "" || cfg.Method == method) && (path == "" || cfg.Path == path) && (folder == "" || cfg.Folder == folder) {
+			mocks = append(mocks, cfg)
+		}
+	}
+	c.Set(fiber.HeaderETag, h.etag())
+	return c.JSON(mocks)
+}
+
+// APIGetMock returns the mock with the given ID
+func (h *MockHandler) APIGetMock(c *fiber.Ctx) error {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	index := h.mockIndex(c.Params("id"))
+	if index < 0 {
+		return mockNotFound(c, c.Params("id"))
+	}
+	c.Set(fiber.HeaderETag, config.ETag(h.Configs[index]))
+	return c.JSON(h.Configs[index])
+}
+
+// APICreateMock adds a mock at the end of the list. It gets an ID unless the
+// body brings an unused one.
+func (h *MockHandler) APICreateMock(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	var cfg model.MockConfig
+	if err := decodeJSON(c.Body(), &cfg); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid mock: " + err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if cfg.ID != "" && h.mockIndex(cfg.ID) >= 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "mock already exists: " + cfg.ID})
+	}
+	base := h.baseConfigs(c)
+	cfgs := append(append([]model.MockConfig{}, base...), cfg)
+	config.EnsureIDs(cfgs)
+	id := cfgs[len(cfgs)-1].ID
+	cfgs, handled, err := h.matchVersion(c, cfgs)
+	if handled {
+		return err
+	}
+	if handled, err := h.applyConfigs(c, "create", cfgs); handled {
+		return err
+	}
+	created := cfgs[indexOfMock(cfgs, id)]
+	c.Location(strings.TrimRight(c.Path(), "/") + "/" + created.ID)
+	return c.Status(201).JSON(created)
+}
+
+// APIReplaceMocks replaces the whole set of mocks with the array in the body.
+// With an outdated If-Match it is merged with the changes made since, like a
+// save from the editor.
+func (h *MockHandler) APIReplaceMocks(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	var cfgs []model.MockConfig
+	if err := decodeJSON(c.Body(), &cfgs); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid mocks: " + err.Error()})
+	}
+	if cfgs == nil {
+		cfgs = []model.MockConfig{}
+	}
+	config.EnsureIDs(cfgs)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfgs, handled, err := h.matchVersion(c, cfgs)
+	if handled {
+		return err
+	}
+	if handled, err := h.applyConfigs(c, "replace", cfgs); handled {
+		return err
+	}
+	return c.JSON(cfgs)
+}
+
+// APIUpdateMock replaces the mock with the given ID, keeping its position.
+// An ID in the body must match the one in the path.
+func (h *MockHandler) APIUpdateMock(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	id := c.Params("id")
+	var cfg model.MockConfig
+	if err := decodeJSON(c.Body(), &cfg); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid mock: " + err.Error()})
+	}
+	if cfg.ID != "" && cfg.ID != id {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("mock id %q does not match %q", cfg.ID, id)})
+	}
+	cfg.ID = id
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.updateMock(c, "update", cfg)
+}
+
+// APIPatchMock applies a JSON merge patch (RFC 7396) to the mock with the
+// given ID: fields in the body replace those of the mock, objects are merged
+// and null removes a field
+func (h *MockHandler) APIPatchMock(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	id := c.Params("id")
+	var patch interface{}
+	if err := json.Unmarshal(c.Body(), &patch); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid patch: " + err.Error()})
+	}
+	if _, ok := patch.(map[string]interface{}); !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "patch must be a JSON object"})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index := h.mockIndex(id)
+	if index < 0 {
+		return mockNotFound(c, id)
+	}
+	var current interface{}
+	data, _ := json.Marshal(h.Configs[index])
+	_ = json.Unmarshal(data, &current)
+	data, _ = json.Marshal(mergePatch(current, patch))
+
+	var cfg model.MockConfig
+	if err := decodeJSON(data, &cfg); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid patch: " + err.Error()})
+	}
+	if cfg.ID != id {
+		return c.Status(400).JSON(fiber.Map{"error": "the id of a mock cannot be changed"})
+	}
+	return h.updateMock(c, "patch", cfg)
+}
+
+// APIDeleteMock removes the mock with the given ID
+func (h *MockHandler) APIDeleteMock(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	id := c.Params("id")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	index := h.mockIndex(id)
+	if index < 0 {
+		return mockNotFound(c, id)
+	}
+	if handled, err := h.matchMock(c, h.Configs[index]); handled {
+		return err
+	}
+	cfgs := append(append([]model.MockConfig{}, h.Configs[:index]...), h.Configs[index+1:]...)
+	if handled, err := h.applyConfigs(c, "delete", cfgs); handled {
+		return err
+	}
+	return c.SendStatus(204)
+}
+
+// APIBulk applies a BulkRequest as a single change: either every operation
+// succeeds or none is applied. Deletes run first, then updates, then creates.
+// With an outdated If-Match the operations are merged with the changes made
+// since, and fail with 409 when others changed a mock they update or delete.
+func (h *MockHandler) APIBulk(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	var req BulkRequest
+	if err := decodeJSON(c.Body(), &req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "invalid bulk request: " + err.Error()})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	cfgs := append([]model.MockConfig{}, h.baseConfigs(c)...)
+	for _, id := range req.Delete {
+		index := indexOfMock(cfgs, id)
+		if index < 0 {
+			return mockNotFound(c, id)
+		}
+		cfgs = append(cfgs[:index], cfgs[index+1:]...)
+	}
+	for i, cfg := range req.Update {
+		if cfg.ID == "" {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("update #%d has no id", i+1)})
+		}
+		index := indexOfMock(cfgs, cfg.ID)
+		if index < 0 {
+			return mockNotFound(c, cfg.ID)
+		}
+		cfgs[index] = cfg
+	}
+	first := len(cfgs)
+	for _, cfg := range req.Create {
+		if cfg.ID != "" && (indexOfMock(cfgs, cfg.ID) >= 0 || h.mockIndex(cfg.ID) >= 0) {
+			return c.Status(409).JSON(fiber.Map{"error": "mock already exists: " + cfg.ID})
+		}
+		cfgs = append(cfgs, cfg)
+	}
+	config.EnsureIDs(cfgs)
+	createdIDs := make([]string, 0, len(cfgs)-first)
+	for _, cfg := range cfgs[first:] {
+		createdIDs = append(createdIDs, cfg.ID)
+	}
+
+	cfgs, handled, err := h.matchVersion(c, cfgs)
+	if handled {
+		return err
+	}
+	if handled, err := h.applyConfigs(c, "bulk", cfgs); handled {
+		return err
+	}
+	created := make([]model.MockConfig, len(createdIDs))
+	for i, id := range createdIDs {
+		created[i] = cfgs[indexOfMock(cfgs, id)]
+	}
+	updated := make([]model.MockConfig, len(req.Update))
+	for i, cfg := range req.Update {
+		updated[i] = cfgs[indexOfMock(cfgs, cfg.ID)]
+	}
+	deleted := req.Delete
+	if deleted == nil {
+		deleted = []string{}
+	}
+	return c.JSON(fiber.Map{"created": created, "updated": updated, "deleted": deleted})
+}
+
+// APIImport imports the OpenAPI 3.x or Swagger 2.0 document in the body. The
+// mocks are added to the existing ones unless ?merge=false; ?validate=true
+// and ?validateResponses=true check requests and responses against the spec.
+// It fails with 409 when the mocks changed since the If-Match version.
+func (h *MockHandler) APIImport(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	data := bytes.TrimSpace(c.Body())
+	if len(data) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "the body must contain an OpenAPI document"})
+	}
+	isYAML := strings.Contains(c.Get(fiber.HeaderContentType), "yaml") || data[0] != '{'
+
+	spec, status, err := h.parseSpec(data, isYAML, c.Query("validate") == "true", c.Query("validateResponses") == "true")
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	configs := spec.configs
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if handled, err := h.matchSet(c); handled {
+		return err
+	}
+	cfgs := configs
+	if c.Query("merge") != "false" {
+		cfgs = append(append([]model.MockConfig{}, h.Configs...), configs...)
+	}
+	config.EnsureIDs(cfgs)
+	if err := h.storeConfigs(c, "import", cfgs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save mocks: " + err.Error()})
+	}
+	if err := h.saveSpec(spec); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "imported the mocks, but failed to save the spec: " + err.Error()})
+	}
+	return c.Status(201).JSON(cfgs[len(cfgs)-len(configs):])
+}
+
+// APIReset removes every mock and the data of the resource mocks, so a test
+// suite can start from a clean server. The removal is recorded in the
+// history and can be reverted there. It fails with 409 when the mocks changed
+// since the If-Match version.
+func (h *MockHandler) APIReset(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if handled, err := h.matchSet(c); handled {
+		return err
+	}
+
+	removed := len(h.Configs)
+	if err := h.storeConfigs(c, "reset", []model.MockConfig{}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "failed to save mocks: " + err.Error()})
+	}
+	resources := 0
+	if h.Resources != nil {
+		resources = h.Resources.Reset("")
+	}
+	return c.JSON(fiber.Map{"mocks": removed, "resources": resources})
+}
+
+// APINotFound answers requests to unknown admin API endpoints, which would
+// otherwise reach the mocks
+func (h *MockHandler) APINotFound(c *fiber.Ctx) error {
+	return c.Status(404).JSON(fiber.Map{"error": fmt.Sprintf("unknown admin API endpoint: %s %s", c.Method(), c.Path())})
+}
+
+// updateMock replaces the mock with cfg's ID. The caller holds h.mu.
+func (h *MockHandler) updateMock(c *fiber.Ctx, action string, cfg model.MockConfig) error {
+	index := h.mockIndex(cfg.ID)
+	if index < 0 {
+		return mockNotFound(c, cfg.ID)
+	}
+	if handled, err := h.matchMock(c, h.Configs[index]); handled {
+		return err
+	}
+	cfgs := append([]model.MockConfig{}, h.Configs...)
+	cfgs[index] = cfg
+	if handled, err := h.applyConfigs(c, action, cfgs); handled {
+		return err
+	}
+	c.Set(fiber.HeaderETag, config.ETag(cfg))
+	return c.JSON(cfg)
+}
+
+// applyConfigs validates and stores cfgs. It reports whether it answered the
+// request with an error, in which case the returned error is the result. The
+// caller holds h.mu.
+func (h *MockHandler) applyConfigs(c *fiber.Ctx, action string, cfgs []model.MockConfig) (bool, error) {
+	if err := h.checkConfigs(cfgs); err != nil {
+		return true, c.Status(422).JSON(fiber.Map{"error": "invalid mock: " + err.Error()})
+	}
+	if err := h.storeConfigs(c, action, cfgs); err != nil {
+		return true, c.Status(500).JSON(fiber.Map{"error": "failed to save mocks: " + err.Error()})
+	}
+	return false, nil
+}
+
+// mockIndex is the position of the mock with the given ID, or -1. The caller
+// holds h.mu.
+func (h *MockHandler) mockIndex(id string) int {
+	return indexOfMock(h.Configs, id)
+}
+
+func indexOfMock(cfgs []model.MockConfig, id string) int {
+	for i, cfg := range cfgs {
+		if cfg.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func mockNotFound(c *fiber.Ctx, id string) error {
+	return c.Status(404).JSON(fiber.Map{"error": "mock not found: " + id})
+}
+
+// decodeJSON unmarshals data into v, rejecting unknown fields so that typos
+// in scripted requests do not go unnoticed
+func decodeJSON(data []byte, v interface{}) error {
+	if len(bytes.TrimSpace(data)) == 0 {
+		return errors.New("empty body")
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// mergePatch applies a JSON merge patch to target
+func mergePatch(target, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = mergePatch(t[k], v)
+		}
+	}
+	return t
+}
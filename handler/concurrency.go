@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/gofiber/fiber/v2"
+
+	"gopher-mock/config"
+	"gopher-mock/model"
+)
+
+// maxVersions is how many recent config sets are kept for merging writes
+// based on an older one
+const maxVersions = 50
+
+// configVersions remembers recent config sets by ETag, so a write based on an
+// older set can be merged with the changes made since
+type configVersions struct {
+	mu    sync.Mutex
+	sets  map[string][]model.MockConfig
+	order []string
+}
+
+// remember stores cfgs and returns their ETag. The slice must not be modified
+// afterwards.
+func (v *configVersions) remember(cfgs []model.MockConfig) string {
+	etag := config.ETag(cfgs)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.sets == nil {
+		v.sets = make(map[string][]model.MockConfig)
+	}
+	if _, ok := v.sets[etag]; !ok {
+		v.sets[etag] = cfgs
+		v.order = append(v.order, etag)
+		if len(v.order) > maxVersions {
+			delete(v.sets, v.order[0])
+			v.order = v.order[1:]
+		}
+	}
+	return etag
+}
+
+func (v *configVersions) get(etag string) ([]model.MockConfig, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	cfgs, ok := v.sets[etag]
+	return cfgs, ok
+}
+
+// setConfigs makes cfgs the live configs and computes their ETag, so it is
+// not recomputed for every request. The caller holds h.mu for writing.
+func (h *MockHandler) setConfigs(cfgs []model.MockConfig) {
+	h.Configs = cfgs
+	h.current = h.versions.remember(cfgs)
+}
+
+// etag is the ETag of the current configs. The caller holds h.mu.
+func (h *MockHandler) etag() string {
+	if h.current == "" {
+		// Configs set without setConfigs, as in a MockHandler literal
+		return h.versions.remember(h.Configs)
+	}
+	return h.current
+}
+
+// ifMatch returns the If-Match header, without the weak prefix some clients
+// add
+func ifMatch(c *fiber.Ctx) string {
+	return strings.TrimPrefix(strings.TrimSpace(c.Get(fiber.HeaderIfMatch)), "W/")
+}
+
+// requireIfMatch answers a write without an If-Match header with 428, so
+// clients cannot overwrite changes they have not seen by accident. Clients that
+// mean to write regardless send "*". The returned error is the result of the
+// response.
+func requireIfMatch(c *fiber.Ctx) (bool, error) {
+	if ifMatch(c) != "" {
+		return false, nil
+	}
+	return true, c.Status(428).JSON(fiber.Map{"error": "missing If-Match header: send the ETag the configs were read with, or * to write regardless"})
+}
+
+// matchVersion checks a write of the whole set of configs against the
+// If-Match header. A write based on an older version is merged with the
+// changes made since, mock by mock. When that is not possible the request is
+// answered with 409 and the returned error is its result. With "*", cfgs are
+// returned as they are. The caller holds h.mu.
+func (h *MockHandler) matchVersion(c *fiber.Ctx, cfgs []model.MockConfig) ([]model.MockConfig, bool, error) {
+	tag := ifMatch(c)
+	if tag == "*" || tag == h.etag() {
+		return cfgs, false, nil
+	}
+
+	base, ok := h.versions.get(tag)
+	if !ok {
+		// Too old, or from before a restart: all we can tell is what differs
+		changes := config.DiffConfigs(cfgs, h.Configs)
+		keys := make([]string, len(changes))
+		for i, change := range changes {
+			keys[i] = change.Key
+		}
+		return nil, true, h.conflict(c, changes, keys)
+	}
+
+	merged, conflicts := config.MergeConfigs(base, cfgs, h.Configs)
+	if conflicts != nil {
+		log.Printf("Rejected write based on %s: %d mocks changed on both sides", tag, len(conflicts))
+		return nil, true, h.conflict(c, config.DiffConfigs(base, h.Configs), conflicts)
+	}
+	log.Printf("Merged write based on %s with the changes made since", tag)
+	return merged, false, nil
+}
+
+// baseConfigs returns the configs a write was based on: the version named by
+// the If-Match header when it is known, the current configs otherwise. Writes
+// that change a few mocks apply them to it and pass the result to
+// matchVersion, so they merge like a save. The caller holds h.mu.
+func (h *MockHandler) baseConfigs(c *fiber.Ctx) []model.MockConfig {
+	if base, ok := h.versions.get(ifMatch(c)); ok {
+		return base
+	}
+	return h.Configs
+}
+
+// matchSet checks a write that replaces the whole set, such as an import, a
+// revert or a reset, against the If-Match header. Such writes are not merged:
+// any change since that version answers the request with 409 and the
+// returned error is its result. The caller holds h.mu.
+func (h *MockHandler) matchSet(c *fiber.Ctx) (bool, error) {
+	tag := ifMatch(c)
+	if tag == "*" || tag == h.etag() {
+		return false, nil
+	}
+	var changes []config.MockChange
+	if base, ok := h.versions.get(tag); ok {
+		changes = config.DiffConfigs(base, h.Configs)
+	}
+	keys := make([]string, len(changes))
+	for i, change := range changes {
+		keys[i] = change.Key
+	}
+	log.Printf("Rejected write based on %s: the configs changed since", tag)
+	return true, h.conflict(c, changes, keys)
+}
+
+// conflict answers a write based on outdated configs with 409, the current
+// ETag, the mocks changed since and the ids of those that conflict
+func (h *MockHandler) conflict(c *fiber.Ctx, changes []config.MockChange, conflicts []string) error {
+	changed := make([]fiber.Map, len(changes))
+	for i, change := range changes {
+		changed[i] = fiber.Map{"id": change.Key, "name": change.Name, "type": change.Type}
+	}
+	etag := h.etag()
+	c.Set(fiber.HeaderETag, etag)
+	return c.Status(409).JSON(fiber.Map{
+		"error":     "the configs were changed by someone else since they were loaded",
+		"etag":      etag,
+		"changed":   changed,
+		"conflicts": conflicts,
+	})
+}
+
+// matchMock checks a write of one mock against the If-Match header, which
+// must then carry the ETag of that mock as returned by APIGetMock. On a
+// mismatch the request is answered with 409 and the current mock, and the
+// returned error is its result. The caller holds h.mu.
+func (h *MockHandler) matchMock(c *fiber.Ctx, cfg model.MockConfig) (bool, error) {
+	tag := ifMatch(c)
+	if tag == "*" || tag == config.ETag(cfg) {
+		return false, nil
+	}
+	c.Set(fiber.HeaderETag, config.ETag(cfg))
+	return true, c.Status(409).JSON(fiber.Map{
+		"error": "mock " + cfg.ID + " was changed by someone else since it was read",
+		"etag":  config.ETag(cfg),
+		"mock":  cfg,
+	})
+}
@@ -1,11 +1,20 @@
 package handler
 
 import (
+	"encoding/json"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"gopher-mock/config"
 	"gopher-mock/model"
+	"gopher-mock/service"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -69,3 +78,1257 @@ func TestMockHandler_Concurrency(t *testing.T) {
 
 	wg.Wait()
 }
+
+func TestMockHandler_Callbacks(t *testing.T) {
+	var mu sync.Mutex
+	var received []map[string]interface{}
+	var calls int
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		body["path"] = r.URL.Path
+		body["signature"] = r.Header.Get("X-Signature")
+		received = append(received, body)
+	}))
+	defer receiver.Close()
+
+	app := fiber.New()
+	h := &MockHandler{
+		Callbacks: service.NewCallbackDispatcher(),
+		Configs: []model.MockConfig{
+			{
+				Name:   "Create order",
+				Method: "POST",
+				Path:   "/orders/:id",
+				Responses: []model.ConditionalResponse{
+					{
+						Response: model.Response{StatusCode: 202, Body: map[string]interface{}{"status": "accepted"}},
+						Callbacks: []model.Callback{
+							{
+								Name:    "order completed",
+								URL:     receiver.URL + "/hooks/{{path.id}}",
+								Headers: map[string]string{"X-Signature": "{{header.X-Token}}"},
+								Body:    map[string]interface{}{"order": "{{path.id}}", "status": "{{body.status}}"},
+								Retries: 2,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	req := httptest.NewRequest("POST", "/orders/42", strings.NewReader(`{"status":"done"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Token", "abc")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 202 {
+		t.Fatalf("Expected status 202, got %d", resp.StatusCode)
+	}
+
+	h.Callbacks.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != 1 {
+		t.Fatalf("Expected 1 delivered callback, got %d", len(received))
+	}
+	got := received[0]
+	if got["path"] != "/hooks/42" || got["order"] != "42" || got["status"] != "done" || got["signature"] != "abc" {
+		t.Errorf("Unexpected callback payload: %v", got)
+	}
+
+	deliveries := h.Callbacks.Deliveries()
+	if len(deliveries) != 1 {
+		t.Fatalf("Expected 1 delivery record, got %d", len(deliveries))
+	}
+	if deliveries[0].Status != "delivered" || len(deliveries[0].Attempts) != 2 {
+		t.Errorf("Expected delivered after 2 attempts, got %s after %d", deliveries[0].Status, len(deliveries[0].Attempts))
+	}
+}
+
+func TestMockHandler_RuleTargets(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method: "POST",
+				Path:   "/login",
+				Responses: []model.ConditionalResponse{
+					{
+						Rules: []model.Rule{
+							{Target: "cookie", Field: "session", Operator: "equals", Value: "abc"},
+							{Target: "form", Field: "user", Operator: "equals", Value: "alice"},
+							{Target: "contentType", Operator: "contains", Value: "urlencoded"},
+							{Target: "method", Operator: "equals", Value: "POST"},
+							{Target: "rawBody", Operator: "contains", Value: "user=alice"},
+						},
+						Response: model.Response{StatusCode: 200, Body: map[string]interface{}{"user": "{{body.user}}"}},
+					},
+				},
+				DefaultResponse: &model.Response{StatusCode: 401, Body: map[string]interface{}{}},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	req := httptest.NewRequest("POST", "/login", strings.NewReader("user=alice&password=secret"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", "session=abc")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+
+	req = httptest.NewRequest("POST", "/login", strings.NewReader("user=alice"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 401 {
+		t.Fatalf("Expected status 401 without cookie, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_ExpressionOnMissingField(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method: "POST",
+				Path:   "/adults",
+				Responses: []model.ConditionalResponse{
+					{
+						Rules:    []model.Rule{{Target: "expression", Value: "body.age > 18"}},
+						Response: model.Response{StatusCode: 200, Body: map[string]interface{}{}},
+					},
+					{
+						Rules:    []model.Rule{{Target: "expression", Value: "body.user.name == 'a'"}},
+						Response: model.Response{StatusCode: 201, Body: map[string]interface{}{}},
+					},
+				},
+				DefaultResponse: &model.Response{StatusCode: 403, Body: map[string]interface{}{}},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/adults", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 403 {
+		t.Errorf("Expected an empty body to fall through to the default response, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_RequestSchema(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method: "POST",
+				Path:   "/users",
+				RequestSchema: &model.SchemaValidation{
+					Schema: map[string]interface{}{
+						"type":     "object",
+						"required": []interface{}{"name"},
+					},
+					StatusCode: 422,
+					ErrorBody:  map[string]interface{}{"code": "INVALID", "errors": "{{errors}}"},
+				},
+				ResponseBody: map[string]interface{}{"ok": true},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	req := httptest.NewRequest("POST", "/users", strings.NewReader(`{"age":3}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 422 {
+		t.Fatalf("Expected status 422, got %d", resp.StatusCode)
+	}
+	var body map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&body)
+	if errs, ok := body["errors"].([]interface{}); !ok || len(errs) != 1 {
+		t.Errorf("Expected one validation error, got %v", body)
+	}
+
+	req = httptest.NewRequest("POST", "/users", strings.NewReader(`{"name":"alice"}`))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err = app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_SpecValidation(t *testing.T) {
+	spec := `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets", "version": "1.0.0"},
+  "paths": {
+    "/pets/{id}": {
+      "put": {
+        "parameters": [
+          {"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}},
+          {"name": "mode", "in": "query", "schema": {"type": "string", "enum": ["full", "partial"]}}
+        ],
+        "requestBody": {
+          "required": true,
+          "content": {"application/json": {"schema": {"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}}}
+        },
+        "responses": {"200": {"description": "OK"}}
+      }
+    }
+  }
+}`
+	specs := service.NewSpecStore(t.TempDir())
+	id, err := specs.Save([]byte(spec), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method:       "PUT",
+				Path:         "/pets/:id",
+				StatusCode:   200,
+				ResponseBody: map[string]interface{}{"ok": true},
+				Spec:         &model.SpecBinding{ID: id, Path: "/pets/{id}", ValidateRequests: true},
+			},
+		},
+		Specs: specs,
+	}
+	app.All("/*", h.Dynamic)
+
+	cases := []struct {
+		url         string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"/pets/1?mode=full", "application/json", `{"name":"rex"}`, 200},
+		{"/pets/abc", "application/json", `{"name":"rex"}`, 400},
+		{"/pets/1?mode=other", "application/json", `{"name":"rex"}`, 400},
+		{"/pets/1", "application/json", `{"age":3}`, 400},
+		{"/pets/1", "application/json; charset=utf-8", `{"name":"rex"}`, 200},
+		{"/pets/1", "text/plain", `name=rex`, 415},
+		{"/pets/abc", "text/plain", `name=rex`, 415},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest("PUT", tc.url, strings.NewReader(tc.body))
+		req.Header.Set("Content-Type", tc.contentType)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tc.status {
+			t.Errorf("%s %s: expected status %d, got %d", tc.url, tc.body, tc.status, resp.StatusCode)
+		}
+	}
+}
+
+func TestMockHandler_SpecResponseValidation(t *testing.T) {
+	spec := `{
+  "openapi": "3.0.0",
+  "info": {"title": "Pets", "version": "1.0.0"},
+  "paths": {
+    "/pets": {
+      "get": {
+        "responses": {
+          "200": {
+            "description": "OK",
+            "content": {"application/json": {"schema": {
+              "type": "object",
+              "required": ["id", "name"],
+              "properties": {"id": {"type": "integer"}, "name": {"type": "string"}}
+            }}}
+          }
+        }
+      }
+    }
+  }
+}`
+	dir := t.TempDir()
+	specs := service.NewSpecStore(dir)
+	id, err := specs.Save([]byte(spec), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	h := &MockHandler{Path: dir + "/configs.json", Specs: specs}
+	app.Post("/save", h.Save)
+	app.All("/*", h.Dynamic)
+
+	save := func(body map[string]interface{}, status int) int {
+		cfgs := []model.MockConfig{{
+			Name:         "List pets",
+			Method:       "GET",
+			Path:         "/pets",
+			StatusCode:   status,
+			ResponseBody: body,
+			Spec:         &model.SpecBinding{ID: id, Path: "/pets", ValidateResponses: true},
+		}}
+		data, _ := json.Marshal(cfgs)
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp.StatusCode
+	}
+
+	if code := save(map[string]interface{}{"id": "{{path.id}}", "name": "{{faker.name}}"}, 200); code != 200 {
+		t.Fatalf("Expected templated response to be accepted, got %d", code)
+	}
+	if code := save(map[string]interface{}{"id": "seven"}, 200); code != 400 {
+		t.Errorf("Expected mismatching body to be rejected, got %d", code)
+	}
+	if code := save(map[string]interface{}{"id": 1, "name": "rex"}, 404); code != 400 {
+		t.Errorf("Expected undeclared status to be rejected, got %d", code)
+	}
+
+	// The templated id renders as a string, which is reported at request time
+	resp, err := app.Test(httptest.NewRequest("GET", "/pets", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+	}
+	if warning := resp.Header.Get("X-Mock-Spec-Warning"); !strings.Contains(warning, "/id") {
+		t.Errorf("Expected spec warning for id, got %q", warning)
+	}
+
+	// A spec that has gone missing does not block saves
+	h.Specs = service.NewSpecStore(t.TempDir())
+	if code := save(map[string]interface{}{"id": "seven"}, 200); code != 200 {
+		t.Errorf("Expected the save to succeed without the spec, got %d", code)
+	}
+}
+
+func TestMockHandler_SeededFaker(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method:     "GET",
+				Path:       "/users/:id",
+				StatusCode: 200,
+				SeedFrom:   "path.id",
+				ResponseBody: map[string]interface{}{
+					"id":      "{{path.id}}",
+					"name":    "{{faker.name}}",
+					"email":   "{{faker.email}}",
+					"token":   "{{uuid}}",
+					"score":   `{{faker "number" 1 1000000}}`,
+					"friends": map[string]interface{}{"$repeat": "1-5", "$template": "{{faker.first_name}}"},
+				},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	get := func(url string) string {
+		resp, err := app.Test(httptest.NewRequest("GET", url, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body map[string]interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		data, _ := json.Marshal(body)
+		return string(data)
+	}
+
+	first, second, other := get("/users/42"), get("/users/42"), get("/users/43")
+	if first != second {
+		t.Errorf("Expected the same user for the same id:\n%s\n%s", first, second)
+	}
+	if first == other {
+		t.Error("Expected a different user for another id")
+	}
+}
+
+func TestMockHandler_TemplatedStatusAndHeaders(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method: "POST",
+				Path:   "/orders",
+				DefaultResponse: &model.Response{
+					StatusCode:     201,
+					StatusTemplate: "{{query.status}}",
+					Headers: map[string]string{
+						"Location":     "/orders/{{faker.uuid}}",
+						"X-Request-Id": "{{header.X-Request-Id}}",
+					},
+					Body: map[string]interface{}{},
+				},
+				Responses: []model.ConditionalResponse{
+					{
+						Rules:    []model.Rule{{Target: "header", Field: "X-Fail", Operator: "exists", Value: "true"}},
+						Response: model.Response{StatusCode: 500, Body: map[string]interface{}{}},
+					},
+				},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	req := httptest.NewRequest("POST", "/orders", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 201 {
+		t.Errorf("Expected fallback status 201, got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("X-Request-Id"); got != "req-1" {
+		t.Errorf("Expected echoed request id, got %q", got)
+	}
+	if got := resp.Header.Get("Location"); !strings.HasPrefix(got, "/orders/") || strings.Contains(got, "{{") {
+		t.Errorf("Expected rendered location, got %q", got)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/orders?status=409", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 409 {
+		t.Errorf("Expected status 409 from query, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_Resource(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Name: "users",
+				Path: "/users",
+				Resource: &model.ResourceConfig{
+					Data: []interface{}{
+						map[string]interface{}{"id": float64(1), "name": "Alice"},
+						map[string]interface{}{"id": float64(2), "name": "Bob"},
+					},
+				},
+			},
+		},
+		Resources: service.NewResourceStore(),
+	}
+	app.Get("/__admin/resources", h.ResourceData)
+	app.Post("/__admin/resources/reset", h.ResetResources)
+	app.All("/*", h.Dynamic)
+
+	do := func(method, url, body string) (int, interface{}) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var data interface{}
+		_ = json.NewDecoder(resp.Body).Decode(&data)
+		return resp.StatusCode, data
+	}
+
+	if status, data := do("GET", "/users", ""); status != 200 || len(data.([]interface{})) != 2 {
+		t.Fatalf("Expected 2 seeded users, got %d %v", status, data)
+	}
+	if status, data := do("POST", "/users", `{"name":"Carol"}`); status != 201 || data.(map[string]interface{})["id"] != float64(3) {
+		t.Errorf("Expected Carol to be created with id 3, got %d %v", status, data)
+	}
+	if status, _ := do("POST", "/users", `{"id":1,"name":"Dup"}`); status != 409 {
+		t.Errorf("Expected 409 for a duplicate id, got %d", status)
+	}
+	if status, data := do("PATCH", "/users/1", `{"email":"alice@example.com","name":null}`); status != 200 {
+		t.Errorf("Expected 200 from PATCH, got %d", status)
+	} else if item := data.(map[string]interface{}); item["email"] != "alice@example.com" || item["name"] != nil {
+		t.Errorf("Unexpected patched item: %v", item)
+	}
+	if status, data := do("PUT", "/users/2", `{"id":99,"name":"Robert"}`); status != 200 || data.(map[string]interface{})["id"] != float64(2) {
+		t.Errorf("Expected PUT to keep id 2, got %d %v", status, data)
+	}
+	if status, _ := do("DELETE", "/users/2", ""); status != 204 {
+		t.Errorf("Expected 204 from DELETE, got %d", status)
+	}
+	for _, method := range []string{"GET", "PUT", "PATCH", "DELETE"} {
+		if status, _ := do(method, "/users/2", `{}`); status != 404 {
+			t.Errorf("Expected 404 from %s of a deleted user, got %d", method, status)
+		}
+	}
+	if status, _ := do("DELETE", "/users", ""); status != 405 {
+		t.Errorf("Expected 405 from DELETE on the collection, got %d", status)
+	}
+
+	h.Configs[0].List = &model.ListConfig{Style: "page", DefaultSize: 1}
+	if _, data := do("GET", "/users?page=2&sort=-id", ""); data.(map[string]interface{})["data"].([]interface{})[0].(map[string]interface{})["id"] != float64(1) {
+		t.Errorf("Expected user 1 on page 2 sorted by descending id, got %v", data)
+	}
+	h.Configs[0].List = nil
+
+	if _, data := do("GET", "/__admin/resources", ""); len(data.(map[string]interface{})["/users"].([]interface{})) != 2 {
+		t.Errorf("Expected the export to hold 2 users, got %v", data)
+	}
+	do("POST", "/__admin/resources/reset", "")
+	if _, data := do("GET", "/users/2", ""); data.(map[string]interface{})["name"] != "Bob" {
+		t.Errorf("Expected Bob to be back after reset, got %v", data)
+	}
+
+	// Changing the seed data reseeds the collection
+	before := h.Configs
+	edited := *before[0].Resource
+	edited.Data = []interface{}{map[string]interface{}{"id": float64(7), "name": "Grace"}}
+	after := []model.MockConfig{before[0]}
+	after[0].Resource = &edited
+	h.Configs = after
+	h.resetChangedResources(before, after)
+	if status, data := do("GET", "/users", ""); status != 200 || len(data.([]interface{})) != 1 {
+		t.Errorf("Expected the edited seed data, got %d %v", status, data)
+	}
+}
+
+func TestMockHandler_PagedList(t *testing.T) {
+	app := fiber.New()
+	h := &MockHandler{
+		Configs: []model.MockConfig{
+			{
+				Method:     "GET",
+				Path:       "/items",
+				StatusCode: 200,
+				ResponseBody: map[string]interface{}{
+					"$repeat":   float64(25),
+					"$template": map[string]interface{}{"id": "{{add .index 1}}"},
+				},
+				List: &model.ListConfig{Style: "link"},
+			},
+		},
+	}
+	app.All("/*", h.Dynamic)
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/items?page=3", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var items []map[string]interface{}
+	_ = json.NewDecoder(resp.Body).Decode(&items)
+	if len(items) != 5 || items[0]["id"] != float64(21) {
+		t.Errorf("Expected items 21-25 on page 3, got %v", items)
+	}
+	if resp.Header.Get("X-Total-Count") != "25" || !strings.Contains(resp.Header.Get("Link"), `rel="prev"`) {
+		t.Errorf("Unexpected paging headers: %v", resp.Header)
+	}
+}
+
+func TestMockHandler_DirectoryStorage(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mocks")
+	h := &MockHandler{Path: dir}
+	app := fiber.New()
+	app.Post("/save", h.Save)
+
+	save := func(cfgs []model.MockConfig) {
+		data, _ := json.Marshal(cfgs)
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp, err := app.Test(req)
+		if err != nil || resp.StatusCode != 200 {
+			t.Fatalf("Save failed: %v %v", err, resp)
+		}
+	}
+
+	save([]model.MockConfig{
+		{Name: "List users", Method: "GET", Path: "/users", Folder: "users"},
+		{Name: "Health", Method: "GET", Path: "/health"},
+		{Name: "Create user", Method: "POST", Path: "/users", Folder: "users/admin"},
+	})
+	for _, name := range []string{"users/list-users.json", "health.json", "users/admin/create-user.json"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("Expected %s to be written: %v", name, err)
+		}
+	}
+
+	loaded, err := config.LoadConfigs(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 3 || loaded[0].Name != "List users" || loaded[2].Folder != "users/admin" {
+		t.Errorf("Unexpected configs after reload: %+v", loaded)
+	}
+
+	save(loaded[:2])
+	if _, err := os.Stat(filepath.Join(dir, "users", "admin")); !os.IsNotExist(err) {
+		t.Errorf("Expected the removed mock's folder to be deleted, got %v", err)
+	}
+}
+
+func TestMockHandler_YAMLStorage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.yaml")
+	original := `# Team mocks
+- name: Health
+  path: /health # liveness probe
+  method: GET
+  statusCode: 200
+  responseBody:
+    status: ok
+- name: Users
+  method: GET
+  path: /users
+  statusCode: 200
+`
+	if err := os.WriteFile(path, []byte(original), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewMockHandler(path)
+	if len(h.Configs) != 2 || h.Configs[0].ResponseBody["status"] != "ok" {
+		t.Fatalf("Unexpected configs from YAML: %+v", h.Configs)
+	}
+
+	app := fiber.New()
+	app.Post("/save", h.Save)
+	cfgs := []model.MockConfig{h.Configs[0]}
+	cfgs[0].StatusCode = 204
+	data, _ := json.Marshal(cfgs)
+	req := httptest.NewRequest("POST", "/save", strings.NewReader(string(data)))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", "*")
+	if resp, err := app.Test(req); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("Save failed: %v %v", err, resp)
+	}
+
+	saved, _ := os.ReadFile(path)
+	text := string(saved)
+	for _, want := range []string{"# Team mocks", "path: /health # liveness probe", "statusCode: 204"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("Expected %q in the saved YAML:\n%s", want, text)
+		}
+	}
+	if strings.Index(text, "path:") > strings.Index(text, "method:") {
+		t.Errorf("Expected the hand-written key order to be kept:\n%s", text)
+	}
+	if strings.Contains(text, "Users") {
+		t.Errorf("Expected the removed mock to be gone:\n%s", text)
+	}
+	for _, noise := range []string{"null", "timeout"} {
+		if strings.Contains(text, noise) {
+			t.Errorf("Expected no unset fields in the saved YAML:\n%s", text)
+		}
+	}
+}
+
+func TestMockHandler_Backups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "configs.json")
+	h := &MockHandler{Path: path}
+	app := fiber.New()
+	app.Post("/save", h.Save)
+	app.Get("/__admin/backups", h.Backups)
+	app.Post("/__admin/backups/:id/restore", h.RestoreBackup)
+
+	save := func(names ...string) {
+		var cfgs []model.MockConfig
+		for _, name := range names {
+			cfgs = append(cfgs, model.MockConfig{Name: name, Method: "GET", Path: "/" + name})
+		}
+		data, _ := json.Marshal(cfgs)
+		req := httptest.NewRequest("POST", "/save", strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		if resp, err := app.Test(req); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("Save failed: %v %v", err, resp)
+		}
+	}
+	save("a")
+	save("a", "b")
+	save("a", "b") // unchanged, no backup
+	save()         // a bad save wiping everything
+
+	resp, _ := app.Test(httptest.NewRequest("GET", "/__admin/backups", nil))
+	var backups []config.Backup
+	_ = json.NewDecoder(resp.Body).Decode(&backups)
+	if len(backups) != 2 || backups[0].Mocks != 2 || backups[1].Mocks != 1 {
+		t.Fatalf("Expected backups with 2 and 1 mocks, got %+v", backups)
+	}
+
+	restore := func(id string) *http.Response {
+		req := httptest.NewRequest("POST", "/__admin/backups/"+id+"/restore", nil)
+		req.Header.Set("If-Match", "*")
+		resp, _ := app.Test(req)
+		return resp
+	}
+	resp = restore(backups[0].ID)
+	if resp.StatusCode != 200 || len(h.Configs) != 2 {
+		t.Fatalf("Expected the restore to bring back 2 mocks, got %d and %d mocks", resp.StatusCode, len(h.Configs))
+	}
+	if etag := resp.Header.Get("ETag"); etag == "" || etag != config.ETag(h.Configs) {
+		t.Errorf("Expected the ETag of the restored configs, got %q", etag)
+	}
+	if loaded, _ := config.LoadConfigs(path); len(loaded) != 2 {
+		t.Errorf("Expected the restored configs on disk, got %d", len(loaded))
+	}
+
+	if resp = restore("configs-missing.json"); resp.StatusCode != 404 {
+		t.Errorf("Expected 404 for an unknown backup, got %d", resp.StatusCode)
+	}
+	entries, _ := os.ReadDir(dir)
+	for _, e := range entries {
+		if strings.Contains(e.Name(), ".tmp-") {
+			t.Errorf("Leftover temporary file %s", e.Name())
+		}
+	}
+}
+
+func TestMockHandler_History(t *testing.T) {
+	h := &MockHandler{Path: filepath.Join(t.TempDir(), "configs.json")}
+	app := fiber.New()
+	app.Post("/save", h.Save)
+	app.Post("/delete-config/:id", h.Delete)
+	app.Get("/__admin/history", h.History)
+	app.Post("/__admin/history/:id/revert", h.RevertRevision)
+
+	send := func(method, url string, body interface{}) *http.Response {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest(method, url, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		req.SetBasicAuth("alice", "secret")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	users := model.MockConfig{Name: "Users", Method: "GET", Path: "/users", StatusCode: 200}
+	orders := model.MockConfig{Name: "Orders", Method: "GET", Path: "/orders", StatusCode: 200}
+	send("POST", "/save", []model.MockConfig{users, orders})
+	users.StatusCode = 500
+	send("POST", "/save", []model.MockConfig{users, orders})
+	send("POST", "/delete-config/"+h.Configs[1].ID, nil)
+
+	var history []config.Revision
+	_ = json.NewDecoder(send("GET", "/__admin/history", nil).Body).Decode(&history)
+	if len(history) != 3 || history[0].Action != "delete" || history[0].Author != "alice" {
+		t.Fatalf("Unexpected history: %+v", history)
+	}
+	modified := history[1].Changes
+	if len(modified) != 1 || modified[0].Type != "modified" || len(modified[0].Fields) != 1 || modified[0].Fields[0].Path != "statusCode" {
+		t.Fatalf("Expected a statusCode change in revision 2, got %+v", modified)
+	}
+	if history[0].Changes[0].Before != nil {
+		t.Errorf("Expected the list to leave out snapshots, got %+v", history[0].Changes[0])
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(h.Path), ".history", "000003.summary.json")); err != nil {
+		t.Errorf("Expected a summary next to the revision: %v", err)
+	}
+
+	// Undo the status change of /users only, keeping the deletion
+	if resp := send("POST", "/__admin/history/2/revert?mock="+url.QueryEscape(h.Configs[0].ID), nil); resp.StatusCode != 200 {
+		t.Fatalf("Expected the mock revert to succeed, got %d", resp.StatusCode)
+	}
+	if len(h.Configs) != 1 || h.Configs[0].StatusCode != 200 {
+		t.Errorf("Expected only /users with status 200, got %+v", h.Configs)
+	}
+
+	// Undo the deletion as a whole
+	send("POST", "/__admin/history/3/revert", nil)
+	if len(h.Configs) != 2 || h.Configs[1].Path != "/orders" {
+		t.Errorf("Expected /orders to be back, got %+v", h.Configs)
+	}
+	if resp := send("POST", "/__admin/history/99/revert", nil); resp.StatusCode != 404 {
+		t.Errorf("Expected 404 for an unknown revision, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_WatchConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(`[{"name": "Users", "method": "GET", "path": "/users", "statusCode": 200}]`)
+
+	h := NewMockHandler(path)
+	stop := make(chan struct{})
+	defer close(stop)
+	go h.WatchConfigs(5*time.Millisecond, stop)
+
+	waitFor := func(check func([]model.MockConfig) bool) bool {
+		for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+			h.mu.RLock()
+			cfgs := h.Configs
+			h.mu.RUnlock()
+			if check(cfgs) {
+				return true
+			}
+		}
+		return false
+	}
+
+	write(`[{"name": "Users", "method": "GET", "path": "/users", "statusCode": 503}]`)
+	if !waitFor(func(cfgs []model.MockConfig) bool { return len(cfgs) == 1 && cfgs[0].StatusCode == 503 }) {
+		t.Fatal("Expected the edited config to be reloaded")
+	}
+
+	// Broken and invalid configs are ignored
+	write(`[{"name": "Users",`)
+	time.Sleep(50 * time.Millisecond)
+	write(`[{"name": "Bad", "method": "GET", "path": "/bad", "responses": [{"rules": [{"target": "nope"}]}]}]`)
+	time.Sleep(50 * time.Millisecond)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if len(h.Configs) != 1 || h.Configs[0].StatusCode != 503 {
+		t.Errorf("Expected the current configs to be kept, got %+v", h.Configs)
+	}
+}
+
+func TestMockHandler_ReloadStaleConfigs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.json")
+	if err := os.WriteFile(path, []byte(`[{"name": "Users", "method": "GET", "path": "/users", "statusCode": 200}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := NewMockHandler(path)
+	if err := os.WriteFile(path, []byte(`[{"name": "Users", "method": "GET", "path": "/users", "statusCode": 503}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that changed after they were fingerprinted are left to the next poll
+	h.reloadConfigs("stale")
+	if h.Configs[0].StatusCode != 200 {
+		t.Errorf("Expected a stale load to be ignored, got %+v", h.Configs)
+	}
+	fingerprint, _ := config.Fingerprint(path)
+	h.reloadConfigs(fingerprint)
+	if h.Configs[0].StatusCode != 503 {
+		t.Errorf("Expected the edited config to be loaded, got %+v", h.Configs)
+	}
+	if h.etag() != config.ETag(h.Configs) {
+		t.Errorf("Expected the ETag of the reloaded configs, got %q", h.etag())
+	}
+}
+
+func TestMockHandler_DeleteByID(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.json")
+	legacy := `[
+		{"name": "A", "method": "GET", "path": "/a"},
+		{"name": "B", "method": "GET", "path": "/b"},
+		{"name": "C", "method": "GET", "path": "/c"},
+		{"name": "D", "method": "GET", "path": "/d"}
+	]`
+	if err := os.WriteFile(path, []byte(legacy), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewMockHandler(path)
+	again, _ := config.LoadConfigs(path)
+	for i, cfg := range h.Configs {
+		if cfg.ID == "" || cfg.ID != again[i].ID {
+			t.Fatalf("Expected legacy mocks to get the same ID on every load, got %q and %q", cfg.ID, again[i].ID)
+		}
+	}
+	ids := map[string]string{}
+	for _, cfg := range h.Configs {
+		ids[cfg.Name] = cfg.ID
+	}
+
+	app := fiber.New()
+	app.Post("/delete-config/:id", h.Delete)
+	app.Post("/delete-configs", h.BulkDelete)
+
+	deleteMock := func(id string) *http.Response {
+		req := httptest.NewRequest("POST", "/delete-config/"+id, nil)
+		req.Header.Set("If-Match", "*")
+		resp, _ := app.Test(req)
+		return resp
+	}
+	if resp := deleteMock(ids["B"]); resp.StatusCode >= 400 {
+		t.Fatalf("Expected B to be deleted, got %d", resp.StatusCode)
+	}
+	// A stale delete of B must not remove another mock
+	if resp := deleteMock(ids["B"]); resp.StatusCode != 404 || len(h.Configs) != 3 {
+		t.Errorf("Expected 404 and 3 mocks left, got %d and %d", resp.StatusCode, len(h.Configs))
+	}
+
+	req := httptest.NewRequest("POST", "/delete-configs", strings.NewReader(`{"ids": ["`+ids["A"]+`", "`+ids["D"]+`", "unknown"]}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("If-Match", "*")
+	if resp, _ := app.Test(req); resp.StatusCode != 200 {
+		t.Fatalf("Expected the bulk delete to succeed, got %d", resp.StatusCode)
+	}
+	if len(h.Configs) != 1 || h.Configs[0].ID != ids["C"] {
+		t.Errorf("Expected only C to be left, got %+v", h.Configs)
+	}
+	if saved, _ := config.LoadConfigs(path); len(saved) != 1 || saved[0].ID != ids["C"] {
+		t.Errorf("Expected C to be saved with its ID, got %+v", saved)
+	}
+}
+
+func TestMockHandler_AdminAPI(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "configs.json")
+	h := NewMockHandler(path)
+	app := fiber.New()
+	api := app.Group("/__admin/api/v1")
+	api.Get("/mocks", h.APIListMocks)
+	api.Post("/mocks", h.APICreateMock)
+	api.Put("/mocks", h.APIReplaceMocks)
+	api.Post("/mocks/bulk", h.APIBulk)
+	api.Get("/mocks/:id", h.APIGetMock)
+	api.Put("/mocks/:id", h.APIUpdateMock)
+	api.Patch("/mocks/:id", h.APIPatchMock)
+	api.Delete("/mocks/:id", h.APIDeleteMock)
+	api.Post("/import", h.APIImport)
+	api.Post("/reset", h.APIReset)
+	api.All("/*", h.APINotFound)
+	app.All("/*", h.Dynamic)
+
+	call := func(method, target, body string, out interface{}) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, "/__admin/api/v1"+target, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", "*")
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp
+	}
+
+	var created model.MockConfig
+	resp := call("POST", "/mocks", `{"name": "Users", "method": "GET", "path": "/users", "statusCode": 200, "responseBody": {"ok": true}}`, &created)
+	if resp.StatusCode != 201 || created.ID == "" {
+		t.Fatalf("Expected 201 with an id, got %d and %+v", resp.StatusCode, created)
+	}
+	if loc := resp.Header.Get("Location"); loc != "/__admin/api/v1/mocks/"+created.ID {
+		t.Errorf("Unexpected Location %q", loc)
+	}
+	if resp = call("POST", "/mocks", `{"id": "`+created.ID+`", "method": "GET", "path": "/x"}`, nil); resp.StatusCode != 409 {
+		t.Errorf("Expected 409 for a duplicate id, got %d", resp.StatusCode)
+	}
+	if resp = call("POST", "/mocks", `{"method": "GET", "path": "/x", "statusCod": 200}`, nil); resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for an unknown field, got %d", resp.StatusCode)
+	}
+
+	var errBody map[string]string
+	if resp = call("GET", "/mocks/missing", "", &errBody); resp.StatusCode != 404 || errBody["error"] != "mock not found: missing" {
+		t.Errorf("Expected a 404 error body, got %d and %v", resp.StatusCode, errBody)
+	}
+
+	var patched model.MockConfig
+	resp = call("PATCH", "/mocks/"+created.ID, `{"statusCode": 202, "responseBody": null, "folder": "users"}`, &patched)
+	if resp.StatusCode != 200 || patched.StatusCode != 202 || patched.ResponseBody != nil || patched.Folder != "users" || patched.Name != "Users" {
+		t.Errorf("Unexpected patch result %d: %+v", resp.StatusCode, patched)
+	}
+	if resp = call("PATCH", "/mocks/"+created.ID, `{"id": "other"}`, nil); resp.StatusCode != 400 {
+		t.Errorf("Expected 400 when patching the id, got %d", resp.StatusCode)
+	}
+	if resp = call("PUT", "/mocks/"+created.ID, `{"id": "other", "method": "GET", "path": "/users"}`, nil); resp.StatusCode != 400 {
+		t.Errorf("Expected 400 for a mismatched id, got %d", resp.StatusCode)
+	}
+	bad := `{"method": "GET", "path": "/users", "responses": [{"rules": [{"target": "nowhere"}], "response": {"statusCode": 200}}]}`
+	if resp = call("PUT", "/mocks/"+created.ID, bad, nil); resp.StatusCode != 422 {
+		t.Errorf("Expected 422 for an invalid rule, got %d", resp.StatusCode)
+	}
+
+	// A bulk request with an unknown id changes nothing
+	if resp = call("POST", "/mocks/bulk", `{"create": [{"method": "GET", "path": "/a"}], "delete": ["missing"]}`, nil); resp.StatusCode != 404 || len(h.Configs) != 1 {
+		t.Errorf("Expected 404 and no change, got %d and %d mocks", resp.StatusCode, len(h.Configs))
+	}
+	var bulk struct {
+		Created []model.MockConfig `json:"created"`
+		Updated []model.MockConfig `json:"updated"`
+	}
+	body := `{"create": [{"method": "GET", "path": "/a"}, {"method": "GET", "path": "/b"}], "update": [{"id": "` + created.ID + `", "method": "GET", "path": "/people"}]}`
+	if resp = call("POST", "/mocks/bulk", body, &bulk); resp.StatusCode != 200 || len(bulk.Created) != 2 || len(bulk.Updated) != 1 {
+		t.Fatalf("Unexpected bulk result %d: %+v", resp.StatusCode, bulk)
+	}
+	var listed []model.MockConfig
+	if call("GET", "/mocks?path=/a", "", &listed); len(listed) != 1 || listed[0].ID != bulk.Created[0].ID {
+		t.Errorf("Expected the filter to find /a, got %+v", listed)
+	}
+	if resp = call("DELETE", "/mocks/"+bulk.Created[1].ID, "", nil); resp.StatusCode != 204 {
+		t.Errorf("Expected 204, got %d", resp.StatusCode)
+	}
+	if saved, _ := config.LoadConfigs(path); len(saved) != 2 || saved[0].Path != "/people" {
+		t.Errorf("Expected the changes to be saved, got %+v", saved)
+	}
+
+	spec := `openapi: 3.0.0
+info: {title: Pets, version: 1.0.0}
+paths:
+  /pets:
+    get:
+      responses:
+        "200": {description: OK}
+`
+	var imported []model.MockConfig
+	if resp = call("POST", "/import?merge=false", spec, &imported); resp.StatusCode != 201 || len(imported) != 1 || imported[0].ID == "" {
+		t.Fatalf("Unexpected import result %d: %+v", resp.StatusCode, imported)
+	}
+	if len(h.Configs) != 1 || h.Configs[0].Path != "/pets" {
+		t.Errorf("Expected the import to replace the mocks, got %+v", h.Configs)
+	}
+
+	if resp = call("POST", "/reset", "", nil); resp.StatusCode != 200 || len(h.Configs) != 0 {
+		t.Errorf("Expected the reset to remove every mock, got %d and %d", resp.StatusCode, len(h.Configs))
+	}
+	if resp = call("GET", "/nothing", "", &errBody); resp.StatusCode != 404 || !strings.Contains(errBody["error"], "unknown admin API endpoint") {
+		t.Errorf("Expected a JSON 404 for unknown endpoints, got %d and %v", resp.StatusCode, errBody)
+	}
+}
+
+func TestMockHandler_OptimisticConcurrency(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.json")
+	initial := `[
+		{"id": "users", "name": "Users", "method": "GET", "path": "/users", "statusCode": 200},
+		{"id": "orders", "name": "Orders", "method": "GET", "path": "/orders", "statusCode": 200}
+	]`
+	if err := os.WriteFile(path, []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := NewMockHandler(path)
+	app := fiber.New()
+	app.Post("/save", h.Save)
+	app.Get("/__admin/api/v1/mocks", h.APIListMocks)
+	app.Get("/__admin/api/v1/mocks/:id", h.APIGetMock)
+	app.Patch("/__admin/api/v1/mocks/:id", h.APIPatchMock)
+
+	send := func(method, url, ifMatch string, body interface{}, out interface{}) *http.Response {
+		t.Helper()
+		data, _ := json.Marshal(body)
+		if s, ok := body.(string); ok {
+			data = []byte(s)
+		}
+		req := httptest.NewRequest(method, url, strings.NewReader(string(data)))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if out != nil {
+			json.NewDecoder(resp.Body).Decode(out)
+		}
+		return resp
+	}
+
+	var loaded []model.MockConfig
+	loadedTag := send("GET", "/__admin/api/v1/mocks", "", nil, &loaded).Header.Get("ETag")
+	if loadedTag == "" || len(loaded) != 2 {
+		t.Fatalf("Expected the mocks with an ETag, got %q and %+v", loadedTag, loaded)
+	}
+	if resp := send("POST", "/save", "", loaded, nil); resp.StatusCode != 428 {
+		t.Errorf("Expected 428 without If-Match, got %d", resp.StatusCode)
+	}
+
+	// Two editors start from the same configs and change different mocks
+	alice := append([]model.MockConfig{}, loaded...)
+	alice[0].StatusCode = 201
+	resp := send("POST", "/save", loadedTag, alice, nil)
+	if resp.StatusCode != 200 || resp.Header.Get("ETag") == loadedTag {
+		t.Fatalf("Expected Alice's save to succeed with a new ETag, got %d and %q", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	bob := append([]model.MockConfig{}, loaded...)
+	bob[1].StatusCode = 202
+	bob = append(bob, model.MockConfig{Name: "Carts", Method: "GET", Path: "/carts", StatusCode: 200})
+	if resp := send("POST", "/save", loadedTag, bob, nil); resp.StatusCode != 200 {
+		t.Fatalf("Expected Bob's save to merge, got %d", resp.StatusCode)
+	}
+	if len(h.Configs) != 3 || h.Configs[0].StatusCode != 201 || h.Configs[1].StatusCode != 202 || h.Configs[2].Path != "/carts" {
+		t.Errorf("Expected both edits and the new mock, got %+v", h.Configs)
+	}
+
+	// A third editor changing Alice's mock differently conflicts
+	carol := append([]model.MockConfig{}, loaded...)
+	carol[0].StatusCode = 500
+	var conflict struct {
+		ETag    string `json:"etag"`
+		Changed []struct {
+			ID string `json:"id"`
+		} `json:"changed"`
+		Conflicts []string `json:"conflicts"`
+	}
+	if resp := send("POST", "/save", loadedTag, carol, &conflict); resp.StatusCode != 409 {
+		t.Fatalf("Expected 409, got %d", resp.StatusCode)
+	}
+	if len(conflict.Conflicts) != 1 || conflict.Conflicts[0] != "users" || len(conflict.Changed) != 3 || conflict.ETag == "" {
+		t.Errorf("Unexpected conflict body %+v", conflict)
+	}
+	if h.Configs[0].StatusCode != 201 {
+		t.Errorf("Expected the conflicting save to change nothing, got %d", h.Configs[0].StatusCode)
+	}
+	if resp := send("POST", "/save", `"unknown"`, carol, nil); resp.StatusCode != 409 {
+		t.Errorf("Expected 409 for an unknown ETag, got %d", resp.StatusCode)
+	}
+
+	// Single mocks carry their own ETag
+	mockTag := send("GET", "/__admin/api/v1/mocks/orders", "", nil, nil).Header.Get("ETag")
+	if resp := send("PATCH", "/__admin/api/v1/mocks/orders", loadedTag, `{"statusCode": 204}`, nil); resp.StatusCode != 409 {
+		t.Errorf("Expected 409 for a stale mock ETag, got %d", resp.StatusCode)
+	}
+	if resp := send("PATCH", "/__admin/api/v1/mocks/orders", mockTag, `{"statusCode": 204}`, nil); resp.StatusCode != 200 || h.Configs[1].StatusCode != 204 {
+		t.Errorf("Expected the patch to apply, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_ConditionalWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "configs.json")
+	initial := `[
+		{"id": "users", "name": "Users", "method": "GET", "path": "/users", "statusCode": 200},
+		{"id": "orders", "name": "Orders", "method": "GET", "path": "/orders", "statusCode": 200}
+	]`
+	if err := os.WriteFile(path, []byte(initial), 0644); err != nil {
+		t.Fatal(err)
+	}
+	h := NewMockHandler(path)
+	app := fiber.New()
+	app.Post("/save", h.Save)
+	app.Post("/delete-config/:id", h.Delete)
+	app.Get("/__admin/api/v1/mocks", h.APIListMocks)
+	app.Post("/__admin/api/v1/mocks", h.APICreateMock)
+	app.Post("/__admin/api/v1/mocks/bulk", h.APIBulk)
+	app.Post("/__admin/api/v1/reset", h.APIReset)
+
+	send := func(method, url, ifMatch, body string) *http.Response {
+		t.Helper()
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("If-Match", ifMatch)
+		resp, err := app.Test(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	var loaded []model.MockConfig
+	resp := send("GET", "/__admin/api/v1/mocks", "", "")
+	loadedTag := resp.Header.Get("ETag")
+	_ = json.NewDecoder(resp.Body).Decode(&loaded)
+	changed := append([]model.MockConfig{}, loaded...)
+	changed[0].StatusCode = 500
+	data, _ := json.Marshal(changed)
+	send("POST", "/save", "*", string(data))
+
+	// Every write needs If-Match, "*" to write regardless
+	for _, url := range []string{"/delete-config/users", "/__admin/api/v1/mocks", "/__admin/api/v1/mocks/bulk", "/__admin/api/v1/reset"} {
+		if resp := send("POST", url, "", `{}`); resp.StatusCode != 428 {
+			t.Errorf("Expected 428 for %s without If-Match, got %d", url, resp.StatusCode)
+		}
+	}
+
+	// Writes based on the loaded configs merge unless they touch /users
+	if resp := send("POST", "/delete-config/users", loadedTag, ""); resp.StatusCode != 409 {
+		t.Errorf("Expected 409 deleting a mock changed since, got %d", resp.StatusCode)
+	}
+	if resp := send("POST", "/__admin/api/v1/mocks/bulk", loadedTag, `{"update": [{"id": "users", "method": "GET", "path": "/users", "statusCode": 201}]}`); resp.StatusCode != 409 {
+		t.Errorf("Expected 409 updating a mock changed since, got %d", resp.StatusCode)
+	}
+	if resp := send("POST", "/__admin/api/v1/mocks", loadedTag, `{"id": "carts", "method": "GET", "path": "/carts", "statusCode": 200}`); resp.StatusCode != 201 {
+		t.Errorf("Expected the create to merge, got %d", resp.StatusCode)
+	}
+	if resp := send("POST", "/delete-config/orders", loadedTag, ""); resp.StatusCode >= 400 {
+		t.Errorf("Expected the delete to merge, got %d", resp.StatusCode)
+	}
+	if len(h.Configs) != 2 || h.Configs[0].StatusCode != 500 || h.Configs[1].ID != "carts" {
+		t.Errorf("Expected the changed /users and the new /carts, got %+v", h.Configs)
+	}
+
+	// Whole-set writes are not merged
+	if resp := send("POST", "/__admin/api/v1/reset", loadedTag, ""); resp.StatusCode != 409 || len(h.Configs) != 2 {
+		t.Errorf("Expected 409 resetting outdated mocks, got %d", resp.StatusCode)
+	}
+	h.mu.Lock()
+	current := h.etag()
+	h.mu.Unlock()
+	if resp := send("POST", "/__admin/api/v1/reset", current, ""); resp.StatusCode != 200 || len(h.Configs) != 0 {
+		t.Errorf("Expected the reset to apply, got %d", resp.StatusCode)
+	}
+}
+
+func TestMockHandler_Swagger2Import(t *testing.T) {
+	spec := `swagger: "2.0"
+info: {title: Pets, version: "1.0"}
+paths:
+  /pets/{id}:
+    get:
+      parameters:
+        - {name: id, in: path, required: true, type: integer}
+      responses:
+        "200":
+          description: OK
+          schema:
+            type: object
+            properties:
+              name: {type: string}
+`
+	dir := t.TempDir()
+	h := NewMockHandler(filepath.Join(dir, "configs.json"))
+	app := fiber.New()
+	app.Post("/import", h.APIImport)
+	app.All("/*", h.Dynamic)
+
+	// A rejected import leaves no spec behind
+	req := httptest.NewRequest("POST", "/import?validate=true", strings.NewReader(spec))
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("If-Match", `"outdated"`)
+	if resp, _ := app.Test(req); resp.StatusCode != 409 {
+		t.Fatalf("Expected 409 for an outdated import, got %d", resp.StatusCode)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "specs")); !os.IsNotExist(err) {
+		t.Errorf("Expected no spec to be saved for a rejected import, got %v", err)
+	}
+
+	req = httptest.NewRequest("POST", "/import?validate=true", strings.NewReader(spec))
+	req.Header.Set("Content-Type", "application/yaml")
+	req.Header.Set("If-Match", "*")
+	resp, err := app.Test(req)
+	if err != nil || resp.StatusCode != 201 {
+		t.Fatalf("Expected the Swagger 2.0 spec to import, got %v %v", err, resp)
+	}
+	if len(h.Configs) != 1 || h.Configs[0].Spec == nil || h.Configs[0].Spec.ID == "" || !h.Configs[0].Spec.ValidateRequests {
+		t.Fatalf("Expected the mock to be bound to the stored spec, got %+v", h.Configs)
+	}
+
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/pets/abc", nil)); resp.StatusCode != 400 {
+		t.Errorf("Expected a non-integer id to be rejected, got %d", resp.StatusCode)
+	}
+	if resp, _ := app.Test(httptest.NewRequest("GET", "/pets/42", nil)); resp.StatusCode != 200 {
+		t.Errorf("Expected a valid request to pass, got %d", resp.StatusCode)
+	}
+}
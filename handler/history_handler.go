@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"gopher-mock/config"
+	"gopher-mock/model"
+)
+
+// requestAuthor names who made a change: the X-Mock-Author header, the
+// basic-auth user, or "anonymous"
+func requestAuthor(c *fiber.Ctx) string {
+	if author := strings.TrimSpace(c.Get("X-Mock-Author")); author != "" {
+		return author
+	}
+	if auth := c.Get(fiber.HeaderAuthorization); strings.HasPrefix(auth, "Basic ") {
+		if decoded, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(auth, "Basic ")); err == nil {
+			if user, _, _ := strings.Cut(string(decoded), ":"); user != "" {
+				return user
+			}
+		}
+	}
+	return "anonymous"
+}
+
+// recordRevision adds a mutation to the history. Failures are logged only;
+// the change itself has already been saved.
+func (h *MockHandler) recordRevision(c *fiber.Ctx, action string, before, after []model.MockConfig) {
+	rev, err := config.RecordRevision(h.Path, requestAuthor(c), action, before, after)
+	if err != nil {
+		log.Printf("Error recording %s revision: %v", action, err)
+		return
+	}
+	if rev != nil {
+		log.Printf("Recorded revision #%d (%s by %s, %d mocks changed)", rev.ID, rev.Action, rev.Author, len(rev.Changes))
+	}
+}
+
+// History lists the revisions, newest first
+func (h *MockHandler) History(c *fiber.Ctx) error {
+	revisions, err := config.ListRevisions(h.Path)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(revisions)
+}
+
+// HistoryRevision returns one revision with its config snapshots
+func (h *MockHandler) HistoryRevision(c *fiber.Ctx) error {
+	rev, err := h.loadRevision(c)
+	if rev == nil {
+		return err
+	}
+	return c.JSON(rev)
+}
+
+// RevertRevision undoes a revision, for the whole set or, with ?mock=<key>,
+// for a single mock. The revert is itself recorded as a revision. It fails
+// with 409 when the configs changed since the If-Match version.
+func (h *MockHandler) RevertRevision(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+	rev, err := h.loadRevision(c)
+	if rev == nil {
+		return err
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if handled, err := h.matchSet(c); handled {
+		return err
+	}
+
+	key := c.Query("mock")
+	cfgs, err := config.RevertRevision(rev, h.Configs, key)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := h.storeConfigs(c, "revert", cfgs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save configurations"})
+	}
+
+	message := fmt.Sprintf("Reverted revision #%d", rev.ID)
+	if key != "" {
+		message = fmt.Sprintf("Reverted %s from revision #%d", key, rev.ID)
+	}
+	log.Println(message)
+	return c.JSON(fiber.Map{"success": true, "message": message})
+}
+
+// loadRevision reads the revision named by the :id parameter. When it fails,
+// the error response has been sent and the returned error is its result.
+func (h *MockHandler) loadRevision(c *fiber.Ctx) (*config.Revision, error) {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return nil, c.Status(400).JSON(fiber.Map{"error": "invalid revision id"})
+	}
+	rev, err := config.LoadRevision(h.Path, id)
+	if errors.Is(err, config.ErrRevisionNotFound) {
+		return nil, c.Status(404).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err != nil {
+		return nil, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return rev, nil
+}
@@ -2,15 +2,18 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 	"github.com/rs/zerolog"
 
 	"gopher-mock/config"
@@ -20,10 +23,16 @@ import (
 
 // MockHandler ...
 type MockHandler struct {
-	mu      sync.RWMutex
-	Configs []model.MockConfig
-	Path    string
-	Log     zerolog.Logger
+	mu        sync.RWMutex
+	Configs   []model.MockConfig
+	Path      string
+	Log       zerolog.Logger
+	Callbacks *service.CallbackDispatcher
+	Specs     *service.SpecStore
+	Seed      int64 // global faker seed, from MOCK_SEED
+	Resources *service.ResourceStore
+	versions  configVersions
+	current   string // ETag of Configs, see setConfigs
 }
 
 // NewMockHandler ...
@@ -36,21 +45,34 @@ func NewMockHandler(path string) *MockHandler {
 		log.Println("Load config error:", err)
 	} else {
 		log.Printf("Successfully loaded %d configs\n", len(cfgs))
+		logInvalidConfigs(cfgs)
 	}
 	if cfgs == nil {
 		cfgs = []model.MockConfig{}
 	}
-	return &MockHandler{
-		Configs: cfgs,
-		Path:    path,
-		Log:     zerolog.New(os.Stdout).With().Timestamp().Logger(),
+	var seed int64
+	if v := os.Getenv("MOCK_SEED"); v != "" {
+		if seed, err = strconv.ParseInt(v, 10, 64); err != nil {
+			log.Println("Invalid MOCK_SEED:", err)
+		}
+	}
+	h := &MockHandler{
+		Path:      path,
+		Log:       zerolog.New(os.Stdout).With().Timestamp().Logger(),
+		Callbacks: service.NewCallbackDispatcher(),
+		Specs:     service.NewSpecStore(filepath.Join(filepath.Dir(filepath.Clean(path)), "specs")),
+		Seed:      seed,
+		Resources: service.NewResourceStore(),
 	}
+	h.setConfigs(cfgs)
+	return h
 }
 
 // Index ...
 func (h *MockHandler) Index(c *fiber.Ctx) error {
 	h.mu.RLock()
 	configs := h.Configs
+	etag := h.etag()
 	h.mu.RUnlock()
 
 	// Try to reload if empty (debugging purpose)
@@ -58,22 +80,33 @@ func (h *MockHandler) Index(c *fiber.Ctx) error {
 		log.Println("Configs empty, attempting to reload from", h.Path)
 		loaded, err := config.LoadConfigs(h.Path)
 		if err == nil && len(loaded) > 0 {
+			logInvalidConfigs(loaded)
 			h.mu.Lock()
-			h.Configs = loaded
+			h.setConfigs(loaded)
 			configs = h.Configs
+			etag = h.etag()
 			h.mu.Unlock()
 			log.Println("Reloaded configs:", len(configs))
 		}
 	}
 
 	// log.Printf("Rendering index with %d configs\n", len(h.Configs))
+	// The editor sends the ETag back with its next save
+	c.Set(fiber.HeaderETag, etag)
 	return c.Render("index", fiber.Map{
 		"Configs": configs,
+		"ETag":    etag,
 	})
 }
 
-// Save ...
+// Save replaces the configs with the ones in the body. The If-Match header
+// must carry the ETag of the configs the editor loaded; when others saved
+// since, their changes are merged with these, or 409 lists what changed.
 func (h *MockHandler) Save(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
+
 	// Log the raw body for debugging
 	bodyBytes := c.Body()
 	log.Printf("Received save request, body length: %d bytes", len(bodyBytes))
@@ -86,19 +119,85 @@ func (h *MockHandler) Save(c *fiber.Ctx) error {
 	}
 
 	log.Printf("Successfully parsed %d configurations", len(newCfgs))
+	config.EnsureIDs(newCfgs)
 
-	if err := config.SaveConfigs(h.Path, newCfgs); err != nil {
-		log.Printf("Error saving configs: %v", err)
-		return c.Status(500).SendString("Failed to save configs: " + err.Error())
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	merged := ifMatch(c) != "*" && ifMatch(c) != h.etag()
+	newCfgs, handled, err := h.matchVersion(c, newCfgs)
+	if handled {
+		return err
 	}
 
-	h.mu.Lock()
-	h.Configs = newCfgs
-	h.mu.Unlock()
+	if err := h.checkConfigs(newCfgs); err != nil {
+		log.Printf("Invalid config: %v", err)
+		return c.Status(400).SendString("Invalid config: " + err.Error())
+	}
+	if err := h.storeConfigs(c, "save", newCfgs); err != nil {
+		return c.Status(500).SendString("Failed to save configs: " + err.Error())
+	}
 	log.Println("Configurations saved successfully")
+	if merged {
+		return c.SendString("Config saved and merged with changes made by others since you loaded it")
+	}
 	return c.SendString("Config saved")
 }
 
+// checkConfigs validates the rules and schemas of the configs, and the
+// responses of mocks imported from a spec against that spec. Mocks whose spec
+// cannot be loaded are only logged.
+func (h *MockHandler) checkConfigs(cfgs []model.MockConfig) error {
+	if err := service.ValidateConfigs(cfgs); err != nil {
+		return err
+	}
+	if h.Specs == nil {
+		return nil
+	}
+	for i, cfg := range cfgs {
+		if cfg.Spec == nil || cfg.Spec.ID == "" {
+			continue
+		}
+		problems, err := h.Specs.ValidateMockResponses(cfg)
+		if err != nil {
+			// A missing or broken spec says nothing about the mock, and
+			// must not block saving the other mocks
+			log.Printf("Cannot check config %q against its spec: %v", cfg.Name, err)
+			continue
+		}
+		if len(problems) > 0 {
+			log.Printf("Config %q does not match its spec: %v", cfg.Name, problems)
+			return fmt.Errorf("config #%d (%s) does not match the API specification: %s", i+1, cfg.Name, strings.Join(problems, "; "))
+		}
+	}
+	return nil
+}
+
+// logInvalidConfigs reports the problems of configs loaded from disk. They are
+// loaded anyway, so a later save does not drop them, but their invalid rules
+// never match until they are fixed.
+func logInvalidConfigs(cfgs []model.MockConfig) {
+	for _, err := range service.ConfigErrors(cfgs) {
+		log.Printf("Invalid config, its invalid rules will not match: %v", err)
+	}
+}
+
+// storeConfigs saves cfgs, makes them the live configs and records the
+// change in the history. The response gets the new ETag. The caller holds
+// h.mu.
+func (h *MockHandler) storeConfigs(c *fiber.Ctx, action string, cfgs []model.MockConfig) error {
+	if err := config.SaveConfigs(h.Path, cfgs); err != nil {
+		log.Printf("Error saving configs: %v", err)
+		return err
+	}
+	before := h.Configs
+	h.setConfigs(cfgs)
+	h.resetChangedResources(before, cfgs)
+	h.recordRevision(c, action, before, cfgs)
+	c.Set(fiber.HeaderETag, h.etag())
+	return nil
+}
+
 func min(a, b int) int {
 	if a < b {
 		return a
@@ -106,31 +205,43 @@ func min(a, b int) int {
 	return b
 }
 
-// Delete ...
+// Delete removes the mock with the given ID. It fails with 409 when others
+// changed the mock since the If-Match version.
 func (h *MockHandler) Delete(c *fiber.Ctx) error {
-	index, err := strconv.Atoi(c.Params("index"))
-	if err != nil {
-		return c.Status(400).SendString("Invalid index")
+	if handled, err := requireIfMatch(c); handled {
+		return err
 	}
+	id := c.Params("id")
 
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if index < 0 || index >= len(h.Configs) {
-		return c.Status(400).SendString("Index out of range")
+	base := h.baseConfigs(c)
+	index := indexOfMock(base, id)
+	if index < 0 {
+		return c.Status(404).SendString("Mock not found: " + id)
 	}
 
-	h.Configs = append(h.Configs[:index], h.Configs[index+1:]...)
-	if err := config.SaveConfigs(h.Path, h.Configs); err != nil {
+	cfgs := append(append([]model.MockConfig{}, base[:index]...), base[index+1:]...)
+	cfgs, handled, err := h.matchVersion(c, cfgs)
+	if handled {
+		return err
+	}
+	if err := h.storeConfigs(c, "delete", cfgs); err != nil {
 		return c.Status(500).SendString("Failed to save config")
 	}
 	return c.Redirect("/")
 }
 
-// BulkDelete ...
+// BulkDelete removes the mocks with the given IDs. Unknown IDs are ignored.
+// It fails with 409 when others changed one of the mocks since the If-Match
+// version.
 func (h *MockHandler) BulkDelete(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
 	var body struct {
-		Indices []int `json:"indices"`
+		IDs []string `json:"ids"`
 	}
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(400).SendString("Invalid request body")
@@ -139,28 +250,37 @@ func (h *MockHandler) BulkDelete(c *fiber.Ctx) error {
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	newConfigs := make([]model.MockConfig, 0, len(h.Configs))
-	indexMap := make(map[int]bool)
-	for _, idx := range body.Indices {
-		indexMap[idx] = true
+	base := h.baseConfigs(c)
+	newConfigs := make([]model.MockConfig, 0, len(base))
+	idMap := make(map[string]bool)
+	for _, id := range body.IDs {
+		idMap[id] = true
 	}
 
-	for i, cfg := range h.Configs {
-		if !indexMap[i] {
+	for _, cfg := range base {
+		if !idMap[cfg.ID] {
 			newConfigs = append(newConfigs, cfg)
 		}
 	}
+	deleted := len(base) - len(newConfigs)
 
-	h.Configs = newConfigs
-	if err := config.SaveConfigs(h.Path, h.Configs); err != nil {
+	newConfigs, handled, err := h.matchVersion(c, newConfigs)
+	if handled {
+		return err
+	}
+	if err := h.storeConfigs(c, "bulk-delete", newConfigs); err != nil {
 		return c.Status(500).SendString("Failed to save config")
 	}
 
-	return c.JSON(fiber.Map{"success": true, "message": fmt.Sprintf("Deleted %d configurations", len(body.Indices))})
+	return c.JSON(fiber.Map{"success": true, "message": fmt.Sprintf("Deleted %d configurations", deleted)})
 }
 
-// ImportOpenAPI imports OpenAPI/Swagger specification and generates mock configs
+// ImportOpenAPI imports OpenAPI/Swagger specification and generates mock configs.
+// It fails with 409 when the configs changed since the If-Match version.
 func (h *MockHandler) ImportOpenAPI(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
 	// Get the uploaded file
 	file, err := c.FormFile("file")
 	if err != nil {
@@ -190,48 +310,153 @@ func (h *MockHandler) ImportOpenAPI(c *fiber.Ctx) error {
 	// Get merge option (default: true)
 	merge := c.FormValue("merge") != "false"
 
+	// Validate requests against the spec (default: false)
+	validate := c.FormValue("validate") == "true"
+
+	// Check rendered responses against the spec at request time (default: false)
+	validateResponses := c.FormValue("validateResponses") == "true"
+
 	log.Printf("Importing OpenAPI file: %s (YAML: %v, Merge: %v)", file.Filename, isYAML, merge)
 
+	spec, status, err := h.parseSpec(data, isYAML, validate, validateResponses)
+	if err != nil {
+		return c.Status(status).JSON(fiber.Map{"error": err.Error()})
+	}
+	configs := spec.configs
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if handled, err := h.matchSet(c); handled {
+		return err
+	}
+	cfgs := configs
+	if merge {
+		// Merge with existing configs (append new ones)
+		cfgs = append(append([]model.MockConfig{}, h.Configs...), configs...)
+	}
+	config.EnsureIDs(cfgs)
+	if err := h.storeConfigs(c, "import", cfgs); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Failed to save configurations"})
+	}
+	if err := h.saveSpec(spec); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Imported the endpoints, but failed to save the specification"})
+	}
+
+	return c.JSON(fiber.Map{
+		"success": true,
+		"message": fmt.Sprintf("Successfully imported %d endpoints", len(configs)),
+		"count":   len(configs),
+	})
+}
+
+// parsedSpec holds the mock configs generated from a spec, and the spec they
+// are bound to for validation
+type parsedSpec struct {
+	configs []model.MockConfig
+	data    []byte // nil when the configs are not bound to the spec
+	isYAML  bool
+}
+
+// parseSpec turns an OpenAPI 3.x or Swagger 2.0 document into mock configs
+// bound to the spec, so requests to the mocks can be validated. The spec is
+// not saved yet: see saveSpec. On failure it also returns the status code to
+// answer with.
+func (h *MockHandler) parseSpec(data []byte, isYAML, validate, validateResponses bool) (*parsedSpec, int, error) {
 	// Try to parse as OpenAPI 3.x first
 	configs, err := service.ParseOpenAPISpec(data, isYAML)
 	if err != nil {
-		// If OpenAPI 3.x fails, try Swagger 2.0
+		// Swagger 2.0 is converted to OpenAPI 3.x, and the converted spec
+		// is kept for validation
 		log.Printf("OpenAPI 3.x parsing failed, trying Swagger 2.0: %v", err)
-		configs, err = service.ParseSwagger2Spec(data, isYAML)
-		if err != nil {
-			log.Printf("Swagger 2.0 parsing also failed: %v", err)
-			return c.Status(400).JSON(fiber.Map{"error": "Failed to parse specification: " + err.Error()})
+		converted, convErr := service.ConvertSwagger2(data, isYAML)
+		if convErr == nil {
+			configs, convErr = service.ParseOpenAPISpec(converted, false)
+			data, isYAML = converted, false
+		}
+		if convErr != nil {
+			log.Printf("Swagger 2.0 conversion failed: %v", convErr)
+			if validate || validateResponses {
+				return nil, 400, errors.New("Validation is not supported for this specification: " + convErr.Error())
+			}
+			configs, err = service.ParseSwagger2Spec(data, isYAML)
+			if err != nil {
+				log.Printf("Swagger 2.0 parsing also failed: %v", err)
+				return nil, 400, errors.New("Failed to parse specification: " + err.Error())
+			}
 		}
 	}
 
 	if len(configs) == 0 {
-		return c.Status(400).JSON(fiber.Map{"error": "No endpoints found in specification"})
+		return nil, 400, errors.New("No endpoints found in specification")
 	}
 
 	log.Printf("Successfully parsed %d endpoints from specification", len(configs))
 
+	spec := &parsedSpec{configs: configs}
+	if h.Specs != nil && configs[0].Spec != nil {
+		spec.data, spec.isYAML = data, isYAML
+		id := service.SpecID(data)
+		for i := range configs {
+			configs[i].Spec.ID = id
+			configs[i].Spec.ValidateRequests = validate
+			configs[i].Spec.ValidateResponses = validateResponses
+		}
+	}
+	return spec, 0, nil
+}
+
+// saveSpec stores the spec the imported configs are bound to. It is called
+// once the configs are stored, so a rejected import leaves no spec behind.
+// The caller holds h.mu.
+func (h *MockHandler) saveSpec(spec *parsedSpec) error {
+	if spec.data == nil {
+		return nil
+	}
+	if _, err := h.Specs.Save(spec.data, spec.isYAML); err != nil {
+		log.Printf("Error saving spec: %v", err)
+		return err
+	}
+	return nil
+}
+
+// Backups lists the saved copies of the configs, newest first
+func (h *MockHandler) Backups(c *fiber.Ctx) error {
+	backups, err := config.ListBackups(h.Path)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	return c.JSON(backups)
+}
+
+// RestoreBackup reinstates the configs of a backup. It fails with 409 when
+// the configs changed since the If-Match version.
+func (h *MockHandler) RestoreBackup(c *fiber.Ctx) error {
+	if handled, err := requireIfMatch(c); handled {
+		return err
+	}
 	h.mu.Lock()
 	defer h.mu.Unlock()
 
-	if merge {
-		// Merge with existing configs (append new ones)
-		h.Configs = append(h.Configs, configs...)
-	} else {
-		// Replace all configs
-		h.Configs = configs
+	if handled, err := h.matchSet(c); handled {
+		return err
 	}
 
-	// Save to file
-	if err := config.SaveConfigs(h.Path, h.Configs); err != nil {
-		log.Printf("Error saving configs: %v", err)
-		return c.Status(500).JSON(fiber.Map{"error": "Failed to save configurations"})
+	cfgs, err := config.RestoreBackup(h.Path, c.Params("id"))
+	if err != nil {
+		log.Printf("Restore of backup %q failed: %v", c.Params("id"), err)
+		if errors.Is(err, config.ErrBackupNotFound) {
+			return c.Status(404).JSON(fiber.Map{"error": err.Error()})
+		}
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
 	}
-
-	return c.JSON(fiber.Map{
-		"success": true,
-		"message": fmt.Sprintf("Successfully imported %d endpoints", len(configs)),
-		"count":   len(configs),
-	})
+	before := h.Configs
+	h.setConfigs(cfgs)
+	h.resetChangedResources(before, cfgs)
+	h.recordRevision(c, "restore", before, cfgs)
+	c.Set(fiber.HeaderETag, h.etag())
+	log.Printf("Restored %d configs from backup %q", len(cfgs), c.Params("id"))
+	return c.JSON(fiber.Map{"success": true, "message": fmt.Sprintf("Restored %d configurations", len(cfgs))})
 }
 
 // Dynamic ...
@@ -244,23 +469,56 @@ func (h *MockHandler) Dynamic(c *fiber.Ctx) error {
 	h.mu.RUnlock()
 
 	for _, cfg := range configs {
+		if cfg.Resource != nil {
+			if handled, err := h.serveResource(c, cfg); handled {
+				return err
+			}
+			continue
+		}
 		if cfg.Method == method {
 			if ok, params := pathMatch(cfg.Path, path); ok {
 				// Build request context for rule evaluation
 				ctx := buildRequestContext(c, params)
+				if h.Resources != nil {
+					ctx.State = h.Resources.State()
+				}
+				ctx.Faker = service.NewRequestFaker(h.Seed, cfg, ctx)
+
+				// Reject requests that do not conform to the imported spec
+				if cfg.Spec != nil && cfg.Spec.ValidateRequests && h.Specs != nil {
+					if handled, err := h.validateSpecRequest(c, cfg, params, ctx); handled {
+						return err
+					}
+				}
+
+				// Reject bodies that do not match the mock's request schema
+				if cfg.RequestSchema != nil {
+					if handled, err := validateRequestSchema(c, *cfg.RequestSchema, ctx); handled {
+						return err
+					}
+				}
 
 				// Check if config uses new conditional response format
 				if len(cfg.Responses) > 0 {
 					// Evaluate conditional responses in order
 					for _, condResp := range cfg.Responses {
-						if service.EvaluateRules(condResp.Rules, condResp.RuleOperator, ctx) {
-							return sendResponse(c, condResp.Response, ctx)
+						matched, err := service.EvaluateRules(condResp.Rules, condResp.RuleOperator, ctx)
+						if err != nil {
+							// Rules that cannot be evaluated just do not match
+							log.Printf("Rule evaluation failed for %q (%s): %v", cfg.Name, condResp.Name, err)
+						}
+						if matched {
+							err := h.sendResponse(c, cfg, condResp.Response, ctx)
+							h.dispatchCallbacks(cfg, condResp.Callbacks, ctx)
+							return err
 						}
 					}
 
 					// If no conditional response matched, use default response
 					if cfg.DefaultResponse != nil {
-						return sendResponse(c, *cfg.DefaultResponse, ctx)
+						err := h.sendResponse(c, cfg, *cfg.DefaultResponse, ctx)
+						h.dispatchCallbacks(cfg, nil, ctx)
+						return err
 					}
 				}
 
@@ -286,21 +544,20 @@ func (h *MockHandler) Dynamic(c *fiber.Ctx) error {
 						}
 					}
 				}
-				queryMap := make(map[string]string)
-				c.Request().URI().QueryArgs().VisitAll(func(k, v []byte) {
-					queryMap[string(k)] = string(v)
-				})
+				rendered := pageList(c, cfg, service.RenderTemplate(cfg.ResponseBody, ctx), ctx)
+				status := service.RenderStatusCode(cfg.StatusTemplate, cfg.StatusCode, ctx)
+				h.checkSpecResponse(c, cfg, status, rendered)
 
-				rendered := service.RenderTemplateRecursive(cfg.ResponseBody, service.MapToStringMap(bodyMap), headerMap, queryMap, params)
-
-				for k, v := range cfg.ResponseHeaders {
+				for k, v := range service.RenderHeaders(cfg.ResponseHeaders, ctx) {
 					c.Set(k, v)
 				}
 				if cfg.Timeout > 0 {
 					time.Sleep(time.Duration(cfg.Timeout) * time.Millisecond)
 				}
 
-				return c.Status(cfg.StatusCode).JSON(rendered)
+				err := c.Status(status).JSON(rendered)
+				h.dispatchCallbacks(cfg, nil, ctx)
+				return err
 			}
 		}
 	}
@@ -308,6 +565,31 @@ func (h *MockHandler) Dynamic(c *fiber.Ctx) error {
 	return c.Status(404).SendString("Mock not found")
 }
 
+// dispatchCallbacks schedules the callbacks of the matched conditional
+// response followed by the mock-level callbacks
+func (h *MockHandler) dispatchCallbacks(cfg model.MockConfig, callbacks []model.Callback, ctx service.RequestContext) {
+	if h.Callbacks == nil {
+		return
+	}
+	for _, cb := range append(append([]model.Callback{}, callbacks...), cfg.Callbacks...) {
+		id := h.Callbacks.Dispatch(cfg.Name, cb, ctx)
+		log.Printf("Scheduled callback #%d for %q: %s %s", id, cfg.Name, cb.Method, cb.URL)
+	}
+}
+
+// CallbackDeliveries lists the delivery results of recent callbacks
+func (h *MockHandler) CallbackDeliveries(c *fiber.Ctx) error {
+	if h.Callbacks == nil {
+		return c.JSON([]service.CallbackDelivery{})
+	}
+	return c.JSON(h.Callbacks.Deliveries())
+}
+
+// FakerFunctions lists the faker functions available in templates
+func (h *MockHandler) FakerFunctions(c *fiber.Ctx) error {
+	return c.JSON(service.FakerFunctions())
+}
+
 // buildRequestContext extracts request data into a RequestContext for rule evaluation
 func buildRequestContext(c *fiber.Ctx, pathParams map[string]string) service.RequestContext {
 	// Extract headers
@@ -316,10 +598,18 @@ func buildRequestContext(c *fiber.Ctx, pathParams map[string]string) service.Req
 		headerMap[string(key)] = string(value)
 	})
 
-	// Extract body
+	// Extract body, keeping the parsed JSON for nested path lookups
 	bodyMap := make(map[string]interface{})
+	var bodyData interface{}
 	if c.Method() == "POST" || c.Method() == "PUT" || c.Method() == "PATCH" {
-		_ = c.BodyParser(&bodyMap)
+		if err := json.Unmarshal(c.Body(), &bodyData); err == nil {
+			if m, ok := bodyData.(map[string]interface{}); ok {
+				bodyMap = m
+			}
+		} else {
+			_ = c.BodyParser(&bodyMap)
+			bodyData = bodyMap
+		}
 	}
 
 	// Extract query params
@@ -328,21 +618,129 @@ func buildRequestContext(c *fiber.Ctx, pathParams map[string]string) service.Req
 		queryMap[string(k)] = string(v)
 	})
 
+	// Extract cookies
+	cookieMap := make(map[string]string)
+	c.Request().Header.VisitAllCookie(func(k, v []byte) {
+		cookieMap[string(k)] = string(v)
+	})
+
+	// Extract urlencoded and multipart form fields
+	formMap := make(map[string]string)
+	c.Request().PostArgs().VisitAll(func(k, v []byte) {
+		formMap[string(k)] = string(v)
+	})
+	if strings.HasPrefix(string(c.Request().Header.ContentType()), fiber.MIMEMultipartForm) {
+		if form, err := c.MultipartForm(); err == nil {
+			for k, values := range form.Value {
+				if len(values) > 0 {
+					formMap[k] = values[0]
+				}
+			}
+		}
+	}
+
 	return service.RequestContext{
-		Body:       service.MapToStringMap(bodyMap),
-		Headers:    headerMap,
-		Query:      queryMap,
-		PathParams: pathParams,
+		Body:        service.MapToStringMap(bodyMap),
+		BodyData:    bodyData,
+		Headers:     headerMap,
+		Query:       queryMap,
+		PathParams:  pathParams,
+		Cookies:     cookieMap,
+		Form:        formMap,
+		Method:      c.Method(),
+		RawBody:     string(c.Body()),
+		ClientIP:    c.IP(),
+		ContentType: string(c.Request().Header.ContentType()),
+		Host:        c.Hostname(),
 	}
 }
 
+// validateRequestSchema checks the request body against the schema and sends
+// the configured error response when it does not match. It reports whether a
+// response has been sent.
+func validateRequestSchema(c *fiber.Ctx, v model.SchemaValidation, ctx service.RequestContext) (bool, error) {
+	source, err := service.SchemaSource(v)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	errs, err := service.ValidateJSONSchema(source, ctx.BodyData)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	if len(errs) == 0 {
+		return false, nil
+	}
+
+	status := v.StatusCode
+	if status == 0 {
+		status = 400
+	}
+	body := service.RenderTemplate(service.SchemaErrorBody(v.ErrorBody, errs), ctx)
+	return true, c.Status(status).JSON(body)
+}
+
+// validateSpecRequest checks the request against the spec operation the mock
+// is bound to. Violations are answered with 415 for unsupported content types
+// and 400 otherwise, using the mock's response for that status when it has
+// one. It reports whether a response has been sent.
+func (h *MockHandler) validateSpecRequest(c *fiber.Ctx, cfg model.MockConfig, params map[string]string, ctx service.RequestContext) (bool, error) {
+	req, err := adaptor.ConvertRequest(c, false)
+	if err != nil {
+		return true, c.Status(500).JSON(fiber.Map{"error": err.Error()})
+	}
+	violation, err := h.Specs.ValidateRequest(*cfg.Spec, req, params)
+	if err != nil {
+		log.Printf("Spec validation failed for %q: %v", cfg.Name, err)
+		return true, c.Status(500).JSON(fiber.Map{"error": "spec validation failed: " + err.Error()})
+	}
+	if violation == nil {
+		return false, nil
+	}
+
+	for _, condResp := range cfg.Responses {
+		if condResp.Response.StatusCode == violation.Status {
+			return true, h.sendResponse(c, cfg, condResp.Response, ctx)
+		}
+	}
+	return true, c.Status(violation.Status).JSON(fiber.Map{
+		"error":   "request does not match the API specification",
+		"details": violation.Errors,
+	})
+}
+
+// checkSpecResponse validates a rendered response against the spec when the
+// mock asks for it. Violations do not block the response; they are logged
+// and reported in the X-Mock-Spec-Warning header.
+func (h *MockHandler) checkSpecResponse(c *fiber.Ctx, cfg model.MockConfig, status int, body interface{}) {
+	if cfg.Spec == nil || !cfg.Spec.ValidateResponses || h.Specs == nil {
+		return
+	}
+	problems, err := h.Specs.ValidateResponse(*cfg.Spec, cfg.Method, status, body)
+	if err != nil {
+		problems = []string{err.Error()}
+	}
+	if len(problems) == 0 {
+		return
+	}
+	h.Log.Warn().
+		Str("mock", cfg.Name).
+		Str("method", cfg.Method).
+		Str("path", c.Path()).
+		Int("status", status).
+		Strs("problems", problems).
+		Msg("Response does not match the API specification")
+	c.Set("X-Mock-Spec-Warning", strings.Join(problems, "; "))
+}
+
 // sendResponse sends a response based on the Response configuration
-func sendResponse(c *fiber.Ctx, resp model.Response, ctx service.RequestContext) error {
+func (h *MockHandler) sendResponse(c *fiber.Ctx, cfg model.MockConfig, resp model.Response, ctx service.RequestContext) error {
 	// Render response body with template variables
-	rendered := service.RenderTemplateRecursive(resp.Body, ctx.Body, ctx.Headers, ctx.Query, ctx.PathParams)
+	rendered := pageList(c, cfg, service.RenderTemplate(resp.Body, ctx), ctx)
+	status := service.RenderStatusCode(resp.StatusTemplate, resp.StatusCode, ctx)
+	h.checkSpecResponse(c, cfg, status, rendered)
 
-	// Set response headers
-	for k, v := range resp.Headers {
+	// Set response headers, which may contain templates too
+	for k, v := range service.RenderHeaders(resp.Headers, ctx) {
 		c.Set(k, v)
 	}
 
@@ -352,7 +750,20 @@ func sendResponse(c *fiber.Ctx, resp model.Response, ctx service.RequestContext)
 	}
 
 	// Send response
-	return c.Status(resp.StatusCode).JSON(rendered)
+	return c.Status(status).JSON(rendered)
+}
+
+// pageList pages, filters and sorts a list body when the mock has list
+// settings, setting the paging headers
+func pageList(c *fiber.Ctx, cfg model.MockConfig, body interface{}, ctx service.RequestContext) interface{} {
+	if cfg.List == nil {
+		return body
+	}
+	paged, headers := service.ApplyList(*cfg.List, body, ctx.Query, c.BaseURL()+c.Path())
+	for k, v := range headers {
+		c.Set(k, v)
+	}
+	return paged
 }
 
 func pathMatch(cfgPath, reqPath string) (bool, map[string]string) {
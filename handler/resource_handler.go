@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"gopher-mock/config"
+	"gopher-mock/model"
+	"gopher-mock/service"
+)
+
+// serveResource answers CRUD requests for a resource mock: the collection at
+// cfg.Path and its items at cfg.Path/:id. It reports whether the request
+// belongs to the resource.
+func (h *MockHandler) serveResource(c *fiber.Ctx, cfg model.MockConfig) (bool, error) {
+	path := c.Path()
+	key := service.CollectionKey{Mock: cfg.Path, Path: "/" + strings.Trim(path, "/")}
+	var id string
+	ok, params := pathMatch(cfg.Path, path)
+	if !ok {
+		if ok, params = pathMatch(strings.TrimRight(cfg.Path, "/")+"/:resourceId", path); !ok {
+			return false, nil
+		}
+		id = params["resourceId"]
+		delete(params, "resourceId")
+		key.Path = key.Path[:strings.LastIndex(key.Path, "/")]
+	}
+
+	ctx := buildRequestContext(c, params)
+	ctx.State = h.Resources.State()
+	ctx.Faker = service.NewRequestFaker(h.Seed, cfg, ctx)
+	if cfg.RequestSchema != nil && (ctx.Method == "POST" || ctx.Method == "PUT") {
+		if handled, err := validateRequestSchema(c, *cfg.RequestSchema, ctx); handled {
+			return true, err
+		}
+	}
+
+	for k, v := range service.RenderHeaders(cfg.ResponseHeaders, ctx) {
+		c.Set(k, v)
+	}
+	if cfg.Timeout > 0 {
+		time.Sleep(time.Duration(cfg.Timeout) * time.Millisecond)
+	}
+
+	// Seed data is rendered with a faker that does not depend on the request,
+	// so a seeded mock always starts with the same items
+	res := *cfg.Resource
+	seedFaker := service.NewRequestFaker(h.Seed, cfg, service.RequestContext{})
+	notFound := fiber.Map{"error": "item not found: " + id}
+
+	switch {
+	case id == "" && ctx.Method == "GET":
+		items := h.Resources.List(key, res, seedFaker)
+		if cfg.List == nil {
+			return true, c.JSON(items)
+		}
+		list := make([]interface{}, len(items))
+		for i, item := range items {
+			list[i] = item
+		}
+		return true, c.JSON(pageList(c, cfg, list, ctx))
+	case id == "" && ctx.Method == "POST":
+		item, ok := ctx.BodyData.(map[string]interface{})
+		if !ok {
+			return true, c.Status(400).JSON(fiber.Map{"error": "body must be a JSON object"})
+		}
+		created, err := h.Resources.Create(key, res, seedFaker, item)
+		if err != nil {
+			return true, c.Status(409).JSON(fiber.Map{"error": err.Error()})
+		}
+		return true, c.Status(201).JSON(created)
+	case id != "" && ctx.Method == "GET":
+		if item, ok := h.Resources.Get(key, res, seedFaker, id); ok {
+			return true, c.JSON(item)
+		}
+		return true, c.Status(404).JSON(notFound)
+	case id != "" && (ctx.Method == "PUT" || ctx.Method == "PATCH"):
+		body, ok := ctx.BodyData.(map[string]interface{})
+		if !ok {
+			return true, c.Status(400).JSON(fiber.Map{"error": "body must be a JSON object"})
+		}
+		var item map[string]interface{}
+		if ctx.Method == "PUT" {
+			item, ok = h.Resources.Replace(key, res, seedFaker, id, body)
+		} else {
+			item, ok = h.Resources.Patch(key, res, seedFaker, id, body)
+		}
+		if !ok {
+			return true, c.Status(404).JSON(notFound)
+		}
+		return true, c.JSON(item)
+	case id != "" && ctx.Method == "DELETE":
+		if h.Resources.Delete(key, res, seedFaker, id) {
+			return true, c.SendStatus(204)
+		}
+		return true, c.Status(404).JSON(notFound)
+	}
+
+	if id == "" {
+		c.Set(fiber.HeaderAllow, "GET, POST")
+	} else {
+		c.Set(fiber.HeaderAllow, "GET, PUT, PATCH, DELETE")
+	}
+	return true, c.Status(405).JSON(fiber.Map{"error": "method not allowed: " + ctx.Method})
+}
+
+// ResourceData exports the items of the resource mocks, optionally only the
+// collections under ?path=
+func (h *MockHandler) ResourceData(c *fiber.Ctx) error {
+	if h.Resources == nil {
+		return c.JSON(fiber.Map{})
+	}
+	prefix := strings.TrimRight(c.Query("path"), "/")
+	data := h.Resources.Export()
+	if prefix != "" {
+		for key := range data {
+			if key != prefix && !strings.HasPrefix(key, prefix+"/") {
+				delete(data, key)
+			}
+		}
+	}
+	return c.JSON(data)
+}
+
+// ResetResources restores the resource mocks to their seed data, optionally
+// only the collections under ?path=
+func (h *MockHandler) ResetResources(c *fiber.Ctx) error {
+	if h.Resources == nil {
+		return c.JSON(fiber.Map{"reset": 0})
+	}
+	count := h.Resources.Reset(strings.TrimRight(c.Query("path"), "/"))
+	return c.JSON(fiber.Map{"reset": count})
+}
+
+// resetChangedResources drops the collections of resource mocks whose path,
+// method or resource changed between two config sets, so they are seeded
+// again from the new data
+func (h *MockHandler) resetChangedResources(before, after []model.MockConfig) {
+	if h.Resources == nil {
+		return
+	}
+	for _, change := range config.DiffConfigs(before, after) {
+		if change.Before == nil || change.Before.Resource == nil || !resourceChanged(change) {
+			continue
+		}
+		if n := h.Resources.ResetMock(change.Before.Path); n > 0 {
+			log.Printf("Reset %d collections of resource %s", n, change.Before.Path)
+		}
+	}
+}
+
+func resourceChanged(change config.MockChange) bool {
+	if change.Type != "modified" {
+		return true
+	}
+	for _, field := range change.Fields {
+		if field.Path == "path" || field.Path == "method" || strings.HasPrefix(field.Path, "resource") {
+			return true
+		}
+	}
+	return false
+}
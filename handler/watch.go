@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"strings"
+	"time"
+
+	"gopher-mock/config"
+	"gopher-mock/service"
+)
+
+// WatchConfigs polls the config file or directory and swaps in configs that
+// were changed on disk, e.g. by an editor or a git pull. Configs that fail to
+// load or validate are logged and the current set is kept. It returns when
+// stop is closed.
+func (h *MockHandler) WatchConfigs(interval time.Duration, stop <-chan struct{}) {
+	// The first poll compares the files with the running configs, so edits
+	// made after loading but before the watch started are not missed
+	last := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		fingerprint, err := config.Fingerprint(h.Path)
+		if err != nil || fingerprint == last {
+			continue
+		}
+		last = fingerprint
+		h.reloadConfigs(fingerprint)
+	}
+}
+
+// reloadConfigs loads the configs from disk and swaps them in when they are
+// valid and differ from the running set. fingerprint is that of the files
+// before loading: when they changed meanwhile, e.g. by a save, what was loaded
+// is stale and the next poll loads them again.
+func (h *MockHandler) reloadConfigs(fingerprint string) {
+	loaded, err := config.LoadConfigs(h.Path)
+	if err != nil {
+		log.Printf("Config reload failed, keeping current configs: %v", err)
+		return
+	}
+	if err := service.ValidateConfigs(loaded); err != nil {
+		log.Printf("Config reload failed, keeping current configs: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	// Saves hold h.mu, so the files cannot change between this check and the swap
+	if current, err := config.Fingerprint(h.Path); err != nil || current != fingerprint {
+		return
+	}
+
+	// Our own saves change the files too; they show up as unchanged
+	before := h.Configs
+	current, _ := json.Marshal(before)
+	next, _ := json.Marshal(loaded)
+	if bytes.Equal(current, next) {
+		return
+	}
+	h.setConfigs(loaded)
+	h.resetChangedResources(before, loaded)
+
+	changes := config.DiffConfigs(before, loaded)
+	summary := make([]string, len(changes))
+	for i, change := range changes {
+		summary[i] = change.Type + " " + change.Key
+	}
+	if len(changes) == 0 {
+		summary = []string{"reordered"}
+	}
+	log.Printf("Reloaded %d configs from %s: %s", len(loaded), h.Path, strings.Join(summary, ", "))
+	if _, err := config.RecordRevision(h.Path, "disk", "reload", before, loaded); err != nil {
+		log.Printf("Error recording reload revision: %v", err)
+	}
+}
@@ -2,11 +2,15 @@ package main
 
 import (
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/compress"
 	"github.com/gofiber/template/html/v2"
 
+	"gopher-mock/config"
 	"gopher-mock/handler"
 	"gopher-mock/template"
 )
@@ -21,7 +25,33 @@ func main() {
 		Views: engine,
 	})
 
-	h := handler.NewMockHandler("configs.json")
+	// MOCK_CONFIG is a JSON file, or a directory with one file per mock
+	configPath := os.Getenv("MOCK_CONFIG")
+	if configPath == "" {
+		configPath = "configs.json"
+	}
+	if v := os.Getenv("MOCK_BACKUPS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil {
+			config.MaxBackups = n
+		} else {
+			log.Println("Invalid MOCK_BACKUPS:", err)
+		}
+	}
+	h := handler.NewMockHandler(configPath)
+
+	// Pick up config changes made on disk; MOCK_WATCH=0 turns this off
+	watch := 2 * time.Second
+	if v := os.Getenv("MOCK_WATCH"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Println("Invalid MOCK_WATCH:", err)
+		} else {
+			watch = d
+		}
+	}
+	if watch > 0 {
+		go h.WatchConfigs(watch, nil)
+	}
 
 	app.Use(compress.New(compress.Config{
 		Level: compress.LevelBestSpeed,
@@ -30,8 +60,31 @@ func main() {
 	app.Get("/", h.Index)
 	app.Post("/save", h.Save)
 	app.Post("/import-openapi", h.ImportOpenAPI)
-	app.Post("/delete-config/:index", h.Delete)
+	app.Post("/delete-config/:id", h.Delete)
 	app.Post("/delete-configs", h.BulkDelete)
+	app.Get("/__admin/callbacks", h.CallbackDeliveries)
+	app.Get("/__admin/faker-functions", h.FakerFunctions)
+	app.Get("/__admin/resources", h.ResourceData)
+	app.Post("/__admin/resources/reset", h.ResetResources)
+	app.Get("/__admin/backups", h.Backups)
+	app.Post("/__admin/backups/:id/restore", h.RestoreBackup)
+	app.Get("/__admin/history", h.History)
+	app.Get("/__admin/history/:id", h.HistoryRevision)
+	app.Post("/__admin/history/:id/revert", h.RevertRevision)
+
+	api := app.Group("/__admin/api/v1")
+	api.Get("/mocks", h.APIListMocks)
+	api.Post("/mocks", h.APICreateMock)
+	api.Put("/mocks", h.APIReplaceMocks)
+	api.Post("/mocks/bulk", h.APIBulk)
+	api.Get("/mocks/:id", h.APIGetMock)
+	api.Put("/mocks/:id", h.APIUpdateMock)
+	api.Patch("/mocks/:id", h.APIPatchMock)
+	api.Delete("/mocks/:id", h.APIDeleteMock)
+	api.Post("/import", h.APIImport)
+	api.Post("/reset", h.APIReset)
+	api.All("/*", h.APINotFound)
+
 	app.All("/*", h.RequestResponseLogger(), h.Dynamic)
 
 	log.Fatal(app.Listen(":3000"))
@@ -1,11 +1,16 @@
 package model
 
-// Rule represents a condition to evaluate
+// Rule represents a condition to evaluate. A rule with a Combinator or
+// nested Rules is a group, so rules can form arbitrary AND/OR/NOT trees.
 type Rule struct {
-	Target   string `json:"target"`   // "body", "header", "query", "path"
+	Target   string `json:"target"`   // "body", "header", "query", "path", "cookie", "form", "method", "rawBody", "clientIp", "contentType", "host", "expression"
 	Field    string `json:"field"`    // field name to check
-	Operator string `json:"operator"` // "equals", "contains", "regex", "exists", "gt", "lt"
-	Value    string `json:"value"`    // value to compare against
+	Operator string `json:"operator"` // "equals", "contains", "in", "starts_with", "regex", "exists", "gt", "len_gt", "before", "semver_gt", "cidr", "matches_schema", ...
+	Value    string `json:"value"`    // value to compare against, or the expression for "expression" rules
+
+	Combinator string `json:"combinator,omitempty"` // "AND" or "OR", for groups
+	Rules      []Rule `json:"rules,omitempty"`      // children, for groups
+	Not        bool   `json:"not,omitempty"`        // negates the rule or group
 }
 
 // Response represents a mock response configuration
@@ -14,29 +19,118 @@ type Response struct {
 	Body       map[string]interface{} `json:"body"`
 	StatusCode int                    `json:"statusCode"`
 	Timeout    int                    `json:"timeout"`
+
+	// StatusTemplate overrides StatusCode when it renders to a valid status,
+	// e.g. "{{query.status}}"
+	StatusTemplate string `json:"statusTemplate,omitempty"`
+}
+
+// Callback represents an outbound HTTP request sent after a mock has responded
+type Callback struct {
+	Name       string            `json:"name"`
+	Method     string            `json:"method"` // defaults to "POST"
+	URL        string            `json:"url"`
+	Headers    map[string]string `json:"headers"`
+	Body       interface{}       `json:"body"`       // JSON value, or a string sent as-is
+	Delay      int               `json:"delay"`      // ms to wait before the first attempt
+	Retries    int               `json:"retries"`    // extra attempts after a failed delivery
+	RetryDelay int               `json:"retryDelay"` // ms to wait between attempts
+	Timeout    int               `json:"timeout"`    // ms per attempt, 0 uses the default
 }
 
 // ConditionalResponse represents a response with conditions
 type ConditionalResponse struct {
-	Name         string   `json:"name"`
-	Rules        []Rule   `json:"rules"`
-	RuleOperator string   `json:"ruleOperator"` // "AND" or "OR"
-	Response     Response `json:"response"`
+	Name         string     `json:"name"`
+	Rules        []Rule     `json:"rules"`
+	RuleOperator string     `json:"ruleOperator"` // "AND" or "OR"
+	Response     Response   `json:"response"`
+	Callbacks    []Callback `json:"callbacks,omitempty"`
+}
+
+// SchemaValidation validates request bodies against a JSON Schema and
+// describes the error response sent when they do not match
+type SchemaValidation struct {
+	Schema     map[string]interface{} `json:"schema,omitempty"`     // inline schema, in the OpenAPI 3.0 dialect
+	Ref        string                 `json:"ref,omitempty"`        // path to a JSON or YAML schema file
+	StatusCode int                    `json:"statusCode,omitempty"` // defaults to 400
+	ErrorBody  map[string]interface{} `json:"errorBody,omitempty"`  // "{{errors}}" and "{{message}}" are filled in
+}
+
+// SpecBinding links a mock to an operation of an imported OpenAPI spec
+type SpecBinding struct {
+	ID               string `json:"id"`   // stored spec, see service.SpecStore
+	Path             string `json:"path"` // OpenAPI path template, e.g. /users/{id}
+	ValidateRequests bool   `json:"validateRequests,omitempty"`
+	// ValidateResponses also checks rendered responses at request time and
+	// reports violations in the X-Mock-Spec-Warning header
+	ValidateResponses bool `json:"validateResponses,omitempty"`
+}
+
+// ResourceConfig describes a CRUD resource backed by an in-memory store
+type ResourceConfig struct {
+	IDField string `json:"idField,omitempty"` // defaults to "id"
+	// Data seeds the store. Items may use templates and $repeat directives.
+	Data []interface{} `json:"data,omitempty"`
+}
+
+// ListConfig describes how list responses are paged. Items are filtered with
+// ?field=value (or field_gte, field_lte, field_ne, field_like), searched with
+// ?q= and sorted with ?sort=-age,name before the page is taken.
+type ListConfig struct {
+	// Style is "offset" (?offset=&limit=, the default), "page" (?page=&size=),
+	// "cursor" (?cursor=&limit=) or "link" (?page=&size= with a Link header)
+	Style       string `json:"style,omitempty"`
+	DefaultSize int    `json:"defaultSize,omitempty"` // defaults to 10
+	MaxSize     int    `json:"maxSize,omitempty"`     // defaults to 100
+	// ItemsField names the list in an object body, "data" by default. An
+	// array body is wrapped in an object with this field, except in the
+	// "link" style where paging is reported in headers only.
+	ItemsField string `json:"itemsField,omitempty"`
+	// Filters limits filtering to these fields. By default any query
+	// parameter named after an item field filters.
+	Filters []string `json:"filters,omitempty"`
 }
 
 // MockConfig ...
 type MockConfig struct {
+	ID              string                 `json:"id,omitempty"` // stable identifier, see config.EnsureIDs
 	Name            string                 `json:"name"`
 	Method          string                 `json:"method"`
 	Path            string                 `json:"path"`
-	RequestHeaders  map[string]string      `json:"requestHeaders"`
-	RequestBody     map[string]interface{} `json:"requestBody"`
-	ResponseHeaders map[string]string      `json:"responseHeaders"`
+	RequestHeaders  map[string]string      `json:"requestHeaders,omitempty"`
+	RequestBody     map[string]interface{} `json:"requestBody,omitempty"`
+	ResponseHeaders map[string]string      `json:"responseHeaders,omitempty"`
 	ResponseBody    map[string]interface{} `json:"responseBody"`
 	StatusCode      int                    `json:"statusCode"`
-	Timeout         int                    `json:"timeout"`
+	Timeout         int                    `json:"timeout,omitempty"`
+	StatusTemplate  string                 `json:"statusTemplate,omitempty"` // see Response.StatusTemplate
+	// Folder groups mocks in the editor. With directory storage it is the
+	// subdirectory the mock's file lives in.
+	Folder string `json:"folder,omitempty"`
 
 	// New fields for conditional logic
 	Responses       []ConditionalResponse `json:"responses,omitempty"`
 	DefaultResponse *Response             `json:"defaultResponse,omitempty"`
+
+	// Callbacks are sent for every matched request, after any callbacks
+	// of the matching conditional response
+	Callbacks []Callback `json:"callbacks,omitempty"`
+
+	// RequestSchema rejects requests whose body does not match the schema
+	RequestSchema *SchemaValidation `json:"requestSchema,omitempty"`
+
+	// Spec is set for mocks imported from an OpenAPI spec
+	Spec *SpecBinding `json:"spec,omitempty"`
+
+	// Seed makes faker values reproducible. SeedFrom adds a request value,
+	// e.g. "path.id" or "header.X-Seed", so each value gets its own stable data.
+	Seed     int64  `json:"seed,omitempty"`
+	SeedFrom string `json:"seedFrom,omitempty"`
+
+	// Resource turns the mock into a CRUD collection served at Path, with
+	// items at Path/:id. Method is ignored for resource mocks.
+	Resource *ResourceConfig `json:"resource,omitempty"`
+
+	// List pages, filters and sorts list responses using query parameters
+	List *ListConfig `json:"list,omitempty"`
 }
@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopher-mock/model"
+)
+
+const (
+	defaultCallbackTimeout = 10 * time.Second
+	maxCallbackDeliveries  = 200
+)
+
+// CallbackAttempt records a single try at delivering a callback
+type CallbackAttempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"statusCode,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMs int64     `json:"durationMs"`
+}
+
+// CallbackDelivery records the outcome of a callback triggered by a mock
+type CallbackDelivery struct {
+	ID          int64             `json:"id"`
+	Mock        string            `json:"mock"`
+	Callback    string            `json:"callback"`
+	Method      string            `json:"method"`
+	URL         string            `json:"url"`
+	Status      string            `json:"status"` // "pending", "delivered" or "failed"
+	Attempts    []CallbackAttempt `json:"attempts"`
+	ScheduledAt time.Time         `json:"scheduledAt"`
+	CompletedAt *time.Time        `json:"completedAt,omitempty"`
+}
+
+// CallbackDispatcher sends callbacks in the background and keeps a bounded
+// record of their delivery results
+type CallbackDispatcher struct {
+	Client *http.Client
+
+	mu         sync.Mutex
+	nextID     int64
+	deliveries []*CallbackDelivery
+	wg         sync.WaitGroup
+}
+
+// NewCallbackDispatcher ...
+func NewCallbackDispatcher() *CallbackDispatcher {
+	return &CallbackDispatcher{Client: &http.Client{}}
+}
+
+// Dispatch renders the callback against the request context and delivers it
+// asynchronously. It returns the delivery record ID.
+func (d *CallbackDispatcher) Dispatch(mock string, cb model.Callback, ctx RequestContext) int64 {
+	ctx = cloneRequestContext(ctx)
+
+	method := strings.ToUpper(cb.Method)
+	if method == "" {
+		method = http.MethodPost
+	}
+	url := stringifyValue(RenderTemplate(cb.URL, ctx))
+
+	d.mu.Lock()
+	d.nextID++
+	delivery := &CallbackDelivery{
+		ID:          d.nextID,
+		Mock:        mock,
+		Callback:    cb.Name,
+		Method:      method,
+		URL:         url,
+		Status:      "pending",
+		Attempts:    []CallbackAttempt{},
+		ScheduledAt: time.Now(),
+	}
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > maxCallbackDeliveries {
+		d.deliveries = d.deliveries[len(d.deliveries)-maxCallbackDeliveries:]
+	}
+	d.mu.Unlock()
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		d.deliver(delivery, cb, ctx)
+	}()
+
+	return delivery.ID
+}
+
+// Deliveries returns a snapshot of the recorded deliveries, newest first
+func (d *CallbackDispatcher) Deliveries() []CallbackDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	result := make([]CallbackDelivery, 0, len(d.deliveries))
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		delivery := *d.deliveries[i]
+		delivery.Attempts = append([]CallbackAttempt(nil), delivery.Attempts...)
+		result = append(result, delivery)
+	}
+	return result
+}
+
+// Wait blocks until all in-flight callbacks have finished
+func (d *CallbackDispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// deliver sends the callback, retrying on transport errors and non-2xx responses
+func (d *CallbackDispatcher) deliver(delivery *CallbackDelivery, cb model.Callback, ctx RequestContext) {
+	if cb.Delay > 0 {
+		time.Sleep(time.Duration(cb.Delay) * time.Millisecond)
+	}
+
+	headers := make(map[string]string, len(cb.Headers))
+	for k, v := range cb.Headers {
+		headers[k] = stringifyValue(RenderTemplate(v, ctx))
+	}
+
+	body, isJSON, err := encodeCallbackBody(RenderTemplate(cb.Body, ctx))
+	if err != nil {
+		d.finish(delivery, CallbackAttempt{At: time.Now(), Error: err.Error()}, false)
+		return
+	}
+
+	timeout := defaultCallbackTimeout
+	if cb.Timeout > 0 {
+		timeout = time.Duration(cb.Timeout) * time.Millisecond
+	}
+
+	for attempt := 0; attempt <= cb.Retries; attempt++ {
+		if attempt > 0 && cb.RetryDelay > 0 {
+			time.Sleep(time.Duration(cb.RetryDelay) * time.Millisecond)
+		}
+
+		result := d.send(delivery.Method, delivery.URL, headers, body, isJSON, timeout)
+		done := result.Error == "" && result.StatusCode >= 200 && result.StatusCode < 300
+		if done || attempt == cb.Retries {
+			d.finish(delivery, result, done)
+			return
+		}
+		d.record(delivery, result)
+	}
+}
+
+// send performs a single HTTP request and reports how it went
+func (d *CallbackDispatcher) send(method, url string, headers map[string]string, body []byte, isJSON bool, timeout time.Duration) CallbackAttempt {
+	start := time.Now()
+	attempt := CallbackAttempt{At: start}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	if isJSON {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	client := *d.Client
+	client.Timeout = timeout
+	resp, err := client.Do(req)
+	attempt.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	attempt.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+	return attempt
+}
+
+// record appends an attempt to the delivery
+func (d *CallbackDispatcher) record(delivery *CallbackDelivery, attempt CallbackAttempt) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+}
+
+// finish appends the final attempt and marks the delivery as completed
+func (d *CallbackDispatcher) finish(delivery *CallbackDelivery, attempt CallbackAttempt, delivered bool) {
+	now := time.Now()
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.CompletedAt = &now
+	if delivered {
+		delivery.Status = "delivered"
+	} else {
+		delivery.Status = "failed"
+	}
+}
+
+// encodeCallbackBody converts a rendered callback body into request bytes
+func encodeCallbackBody(body interface{}) ([]byte, bool, error) {
+	switch v := body.(type) {
+	case nil:
+		return nil, false, nil
+	case string:
+		return []byte(v), false, nil
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, false, fmt.Errorf("invalid callback body: %w", err)
+		}
+		return data, true, nil
+	}
+}
+
+// cloneRequestContext copies the request context so it stays valid after
+// the originating request has been released. BodyData is decoded into fresh
+// memory and never mutated, so it is shared, as is the concurrency safe Faker.
+func cloneRequestContext(ctx RequestContext) RequestContext {
+	return RequestContext{
+		Body:        cloneStringMap(ctx.Body),
+		BodyData:    ctx.BodyData,
+		Headers:     cloneStringMap(ctx.Headers),
+		Query:       cloneStringMap(ctx.Query),
+		PathParams:  cloneStringMap(ctx.PathParams),
+		Cookies:     cloneStringMap(ctx.Cookies),
+		Form:        cloneStringMap(ctx.Form),
+		Method:      strings.Clone(ctx.Method),
+		RawBody:     strings.Clone(ctx.RawBody),
+		ClientIP:    strings.Clone(ctx.ClientIP),
+		ContentType: strings.Clone(ctx.ContentType),
+		Host:        strings.Clone(ctx.Host),
+		State:       ctx.State,
+		Vars:        ctx.Vars,
+		Faker:       ctx.Faker,
+	}
+}
+
+func cloneStringMap(m map[string]string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	result := make(map[string]string, len(m))
+	for k, v := range m {
+		result[strings.Clone(k)] = strings.Clone(v)
+	}
+	return result
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+var programCache sync.Map
+
+// expressionOptions configures the expression language used by "expression"
+// rules. Besides the expr built-ins (len, now(), date(), duration(), matches,
+// startsWith, ...) a CEL-style size() is available.
+var expressionOptions = []expr.Option{
+	expr.Env(expressionEnv{}),
+	expr.AsBool(),
+	expr.Function("size", func(params ...any) (any, error) {
+		v := reflect.ValueOf(params[0])
+		switch v.Kind() {
+		case reflect.String, reflect.Slice, reflect.Array, reflect.Map:
+			return v.Len(), nil
+		case reflect.Invalid:
+			return 0, nil
+		}
+		return nil, fmt.Errorf("size() is not defined for %T", params[0])
+	}),
+}
+
+// CompileExpression compiles an expression once and caches the program
+func CompileExpression(src string) (*vm.Program, error) {
+	if v, ok := programCache.Load(src); ok {
+		return v.(*vm.Program), nil
+	}
+	program, err := expr.Compile(src, expressionOptions...)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", src, err)
+	}
+	programCache.Store(src, program)
+	return program, nil
+}
+
+// evaluateExpression runs a boolean expression against the request context.
+// Runtime errors, such as reading a field the request does not have, are
+// returned so the rule does not match.
+func evaluateExpression(src string, ctx RequestContext) (bool, error) {
+	program, err := CompileExpression(src)
+	if err != nil {
+		return false, err
+	}
+	env := newExpressionEnv(ctx)
+	// The state is copied from the store, so only for expressions using it
+	if ctx.State != nil && strings.Contains(src, "state") {
+		env.State = ctx.State()
+	}
+	out, err := expr.Run(program, env)
+	if err != nil {
+		return false, fmt.Errorf("expression %q failed: %w", src, err)
+	}
+	result, _ := out.(bool)
+	return result, nil
+}
+
+// expressionEnv exposes the request to expressions. The values are available
+// at the top level (body, headers, ...) and grouped under request. Header
+// names are lowercased. state holds the items of the resource mocks by path,
+// e.g. state["/users"].
+type expressionEnv struct {
+	Request     map[string]interface{} `expr:"request"`
+	Body        interface{}            `expr:"body"`
+	Headers     map[string]string      `expr:"headers"`
+	Query       map[string]string      `expr:"query"`
+	Path        map[string]string      `expr:"path"`
+	Cookies     map[string]string      `expr:"cookies"`
+	Form        map[string]string      `expr:"form"`
+	Method      string                 `expr:"method"`
+	RawBody     string                 `expr:"rawBody"`
+	ClientIP    string                 `expr:"clientIp"`
+	ContentType string                 `expr:"contentType"`
+	Host        string                 `expr:"host"`
+	State       map[string]interface{} `expr:"state"`
+}
+
+// newExpressionEnv builds the expression environment for a request
+func newExpressionEnv(ctx RequestContext) expressionEnv {
+	var body interface{} = ctx.BodyData
+	if body == nil {
+		m := make(map[string]interface{}, len(ctx.Body))
+		for k, v := range ctx.Body {
+			m[k] = v
+		}
+		body = m
+	}
+
+	headers := make(map[string]string, len(ctx.Headers))
+	for k, v := range ctx.Headers {
+		headers[strings.ToLower(k)] = v
+	}
+
+	env := expressionEnv{
+		Body:        body,
+		Headers:     headers,
+		Query:       nonNilMap(ctx.Query),
+		Path:        nonNilMap(ctx.PathParams),
+		Cookies:     nonNilMap(ctx.Cookies),
+		Form:        nonNilMap(ctx.Form),
+		Method:      ctx.Method,
+		RawBody:     ctx.RawBody,
+		ClientIP:    ctx.ClientIP,
+		ContentType: ctx.ContentType,
+		Host:        ctx.Host,
+		State:       map[string]interface{}{},
+	}
+	env.Request = map[string]interface{}{
+		"body":        env.Body,
+		"headers":     env.Headers,
+		"query":       env.Query,
+		"path":        env.Path,
+		"cookies":     env.Cookies,
+		"form":        env.Form,
+		"method":      env.Method,
+		"rawBody":     env.RawBody,
+		"clientIp":    env.ClientIP,
+		"contentType": env.ContentType,
+		"host":        env.Host,
+	}
+	return env
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+
+	"gopher-mock/model"
+)
+
+// fakerRegex matches {{faker.name}} placeholders with optional arguments,
+// e.g. {{faker.number 1 100}} or {{faker.pick "a" "b"}}
+var fakerRegex = regexp.MustCompile(`\{\{faker\.([a-zA-Z0-9_]+)((?:\s+(?:"(?:[^"\\]|\\.)*"|[^\s"{}]+))*)\s*\}\}`)
+
+var fakerArgRegex = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"|(\S+)`)
+
+// FakerFunction describes a faker function for the editor
+type FakerFunction struct {
+	Name        string   `json:"name"`
+	Category    string   `json:"category"`
+	Description string   `json:"description"`
+	Example     string   `json:"example,omitempty"`
+	Params      []string `json:"params,omitempty"`
+}
+
+// fakerBuiltin is a faker function that takes positional arguments
+type fakerBuiltin struct {
+	description string
+	params      []string
+	fn          func(f *gofakeit.Faker, args []string) (interface{}, error)
+}
+
+func noArgs(fn func(f *gofakeit.Faker) interface{}) func(f *gofakeit.Faker, args []string) (interface{}, error) {
+	return func(f *gofakeit.Faker, args []string) (interface{}, error) {
+		if len(args) > 0 {
+			return nil, fmt.Errorf("takes no arguments")
+		}
+		return fn(f), nil
+	}
+}
+
+// fakerBuiltins are the functions available besides the gofakeit catalogue.
+// They take precedence over gofakeit functions of the same name.
+var fakerBuiltins = map[string]fakerBuiltin{
+	"name":          {"Full name", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Name() })},
+	"first_name":    {"First name", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.FirstName() })},
+	"last_name":     {"Last name", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.LastName() })},
+	"email":         {"Email address", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Email() })},
+	"phone":         {"Phone number", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Phone() })},
+	"company":       {"Company name", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Company() })},
+	"address":       {"Street address", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Address().Address })},
+	"city":          {"City", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.City() })},
+	"country":       {"Country", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Country() })},
+	"uuid":          {"UUID v4", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.UUID() })},
+	"word":          {"Random word", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Word() })},
+	"sentence":      {"Sentence of five words", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Sentence(5) })},
+	"paragraph":     {"Short paragraph", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Paragraph(1, 2, 5, " ") })},
+	"ipv4":          {"IPv4 address", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.IPv4Address() })},
+	"user_agent":    {"Browser user agent", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.UserAgent() })},
+	"url":           {"Web address", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.URL() })},
+	"boolean":       {"true or false", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Bool() })},
+	"time":          {"Time of day (15:04:05)", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Date().Format("15:04:05") })},
+	"hex_color":     {"Hex color", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.HexColor() })},
+	"currency_code": {"Currency code", nil, noArgs(func(f *gofakeit.Faker) interface{} { return f.Currency().Short })},
+	"number": {"Integer between min and max (default 1-1000)", []string{"min", "max"}, func(f *gofakeit.Faker, args []string) (interface{}, error) {
+		min, max, err := intRange(args, 1, 1000)
+		if err != nil {
+			return nil, err
+		}
+		return f.Number(min, max), nil
+	}},
+	"float": {"Decimal between min and max (default 0-1000)", []string{"min", "max"}, func(f *gofakeit.Faker, args []string) (interface{}, error) {
+		min, max := 0.0, 1000.0
+		var err error
+		if len(args) > 0 {
+			if min, err = strconv.ParseFloat(args[0], 64); err != nil {
+				return nil, fmt.Errorf("invalid min %q", args[0])
+			}
+		}
+		if len(args) > 1 {
+			if max, err = strconv.ParseFloat(args[1], 64); err != nil {
+				return nil, fmt.Errorf("invalid max %q", args[1])
+			}
+		}
+		return f.Float64Range(min, max), nil
+	}},
+	"date": {"Date formatted with a Go layout, optionally between two times such as \"-30d\" and \"now\"", []string{"layout", "from", "to"}, fakeDate},
+	"regex": {"String matching a regular expression", []string{"pattern"}, func(f *gofakeit.Faker, args []string) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("regex needs a pattern")
+		}
+		return f.Regex(args[0]), nil
+	}},
+	"pick": {"One of the given values", []string{"values..."}, func(f *gofakeit.Faker, args []string) (interface{}, error) {
+		if len(args) == 0 {
+			return nil, fmt.Errorf("pick needs at least one value")
+		}
+		return f.RandomString(args), nil
+	}},
+}
+
+// defaultFaker generates the values of faker placeholders
+var defaultFaker = gofakeit.New(0)
+
+// NewRequestFaker returns a faker seeded from the global seed, the mock's
+// seed and the request value named by the mock's SeedFrom (e.g. "path.id" or
+// "header.X-Seed"). It returns nil when none of them is set, so values stay
+// random. The mock's method and path are part of the seed, so different mocks
+// produce different values.
+func NewRequestFaker(globalSeed int64, cfg model.MockConfig, ctx RequestContext) *gofakeit.Faker {
+	if globalSeed == 0 && cfg.Seed == 0 && cfg.SeedFrom == "" {
+		return nil
+	}
+
+	h := fnv.New64a()
+	fmt.Fprintf(h, "%d|%d|%s %s", globalSeed, cfg.Seed, cfg.Method, cfg.Path)
+	if cfg.SeedFrom != "" {
+		source, key, _ := strings.Cut(cfg.SeedFrom, ".")
+		fmt.Fprintf(h, "|%s", ctx.sourceValue(source, key))
+	}
+	seed := int64(h.Sum64() &^ (1 << 63))
+	if seed == 0 {
+		seed = 1 // gofakeit treats 0 as "pick a random seed"
+	}
+	return gofakeit.New(seed)
+}
+
+// callFaker runs a faker function by name. Built-in functions are tried
+// first, then the gofakeit catalogue, where positional arguments fill the
+// function's parameters in order.
+func callFaker(f *gofakeit.Faker, name string, args []string) (interface{}, error) {
+	name = strings.ToLower(name)
+	if builtin, ok := fakerBuiltins[name]; ok {
+		return builtin.fn(f, args)
+	}
+
+	info := gofakeit.GetFuncLookup(name)
+	if info == nil {
+		info = gofakeit.GetFuncLookup(strings.ReplaceAll(name, "_", ""))
+	}
+	if info == nil {
+		return nil, fmt.Errorf("unknown faker function %q", name)
+	}
+	if len(args) > len(info.Params) {
+		return nil, fmt.Errorf("faker function %q takes at most %d arguments", name, len(info.Params))
+	}
+
+	params := gofakeit.NewMapParams()
+	for i, arg := range args {
+		params.Add(info.Params[i].Field, arg)
+	}
+	return info.Generate(f.Rand, params, info)
+}
+
+// renderFaker replaces the faker placeholder matched by fakerRegex, leaving
+// it untouched when the function is unknown or fails
+func renderFaker(f *gofakeit.Faker, match []string) (interface{}, bool) {
+	value, err := callFaker(f, match[1], parseFakerArgs(match[2]))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// parseFakerArgs splits `1 100` or `"a b" "c"` into arguments
+func parseFakerArgs(s string) []string {
+	var args []string
+	for _, m := range fakerArgRegex.FindAllStringSubmatch(s, -1) {
+		if m[2] != "" {
+			args = append(args, m[2])
+			continue
+		}
+		args = append(args, strings.ReplaceAll(m[1], `\"`, `"`))
+	}
+	return args
+}
+
+func intRange(args []string, min, max int) (int, int, error) {
+	var err error
+	if len(args) > 0 {
+		if min, err = strconv.Atoi(args[0]); err != nil {
+			return 0, 0, fmt.Errorf("invalid min %q", args[0])
+		}
+	}
+	if len(args) > 1 {
+		if max, err = strconv.Atoi(args[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid max %q", args[1])
+		}
+	}
+	if max < min {
+		min, max = max, min
+	}
+	return min, max, nil
+}
+
+// fakeDate returns a random date, by default formatted as 2006-01-02.
+// The range bounds accept anything parseTimeValue does, and offsets such as
+// "-30d" are taken relative to now.
+func fakeDate(f *gofakeit.Faker, args []string) (interface{}, error) {
+	layout := "2006-01-02"
+	if len(args) > 0 && args[0] != "" {
+		layout = args[0]
+	}
+	if len(args) < 2 {
+		return f.Date().Format(layout), nil
+	}
+
+	now := time.Now()
+	bound := func(s string) (time.Time, error) {
+		if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+			s = "now" + s
+		}
+		return parseTimeValue(s, now)
+	}
+	from, err := bound(args[1])
+	if err != nil {
+		return nil, err
+	}
+	to := now
+	if len(args) > 2 {
+		if to, err = bound(args[2]); err != nil {
+			return nil, err
+		}
+	}
+	return f.DateRange(from, to).Format(layout), nil
+}
+
+// FakerFunctions lists the built-in faker functions and the gofakeit
+// catalogue, sorted by name
+func FakerFunctions() []FakerFunction {
+	seen := make(map[string]bool)
+	var list []FakerFunction
+	for name, builtin := range fakerBuiltins {
+		seen[name] = true
+		list = append(list, FakerFunction{
+			Name:        name,
+			Category:    "builtin",
+			Description: builtin.description,
+			Params:      builtin.params,
+		})
+	}
+	for name, info := range gofakeit.FuncLookups {
+		if seen[name] {
+			continue
+		}
+		fn := FakerFunction{
+			Name:        name,
+			Category:    info.Category,
+			Description: info.Description,
+			Example:     info.Example,
+		}
+		for _, p := range info.Params {
+			fn.Params = append(fn.Params, p.Field)
+		}
+		list = append(list, fn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LookupPath resolves a dot-notation path with array indexing against parsed
+// JSON data. Examples: "user.address.city", "items[0].sku", "$.items.0.sku".
+func LookupPath(data interface{}, path string) (interface{}, bool) {
+	segments, ok := splitPath(path)
+	if !ok {
+		return nil, false
+	}
+
+	current := data
+	for _, segment := range segments {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			val, ok := node[segment]
+			if !ok {
+				return nil, false
+			}
+			current = val
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil {
+				return nil, false
+			}
+			if idx < 0 {
+				idx += len(node)
+			}
+			if idx < 0 || idx >= len(node) {
+				return nil, false
+			}
+			current = node[idx]
+		default:
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// splitPath breaks a path such as "a.b[0].c" into its segments ("a", "b", "0", "c").
+// A leading "$" is accepted and ignored.
+func splitPath(path string) ([]string, bool) {
+	path = strings.TrimPrefix(strings.TrimSpace(path), "$")
+	path = strings.TrimPrefix(path, ".")
+
+	var segments []string
+	var current strings.Builder
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, current.String())
+			current.Reset()
+		}
+	}
+
+	for i := 0; i < len(path); i++ {
+		switch path[i] {
+		case '.':
+			flush()
+		case '[':
+			flush()
+			end := strings.IndexByte(path[i:], ']')
+			if end < 0 {
+				return nil, false
+			}
+			key := strings.Trim(path[i+1:i+end], `"'`)
+			if key == "" {
+				return nil, false
+			}
+			segments = append(segments, key)
+			i += end
+		default:
+			current.WriteByte(path[i])
+		}
+	}
+	flush()
+
+	return segments, true
+}
+
+// stringifyValue converts a parsed JSON value into its string form. Objects
+// and arrays are encoded as JSON rather than Go syntax.
+func stringifyValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case float64:
+		return strconv.FormatFloat(val, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(val)
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(data)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
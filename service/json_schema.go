@@ -0,0 +1,177 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"gopkg.in/yaml.v3"
+
+	"gopher-mock/model"
+)
+
+// schemaCache holds parsed schemas by source. File schemas are reloaded when
+// the file's modification time or size changes.
+var schemaCache sync.Map
+
+type cachedSchema struct {
+	modTime time.Time
+	size    int64
+	schema  *openapi3.Schema
+}
+
+// ValidateJSONSchema validates a parsed JSON value against a schema. The
+// source is either an inline JSON schema or the path of a JSON/YAML schema
+// file. Schemas use the OpenAPI 3.0 dialect of JSON Schema: type, properties,
+// required, items, enum, formats, numeric and length limits, pattern and
+// allOf/anyOf/oneOf/not work, while $ref, const, if/then/else and
+// patternProperties are not supported. It returns the list of validation
+// errors, or an error when the schema itself cannot be loaded.
+func ValidateJSONSchema(source string, value interface{}) ([]string, error) {
+	schema, err := loadSchema(source)
+	if err != nil {
+		return nil, err
+	}
+	if err := schema.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return schemaErrorMessages(err), nil
+	}
+	return nil, nil
+}
+
+// SchemaSource returns the source string ValidateJSONSchema expects for a
+// mock's request validation settings
+func SchemaSource(v model.SchemaValidation) (string, error) {
+	if v.Ref != "" {
+		return v.Ref, nil
+	}
+	if len(v.Schema) == 0 {
+		return "", fmt.Errorf("schema validation needs either a schema or a ref")
+	}
+	data, err := json.Marshal(v.Schema)
+	if err != nil {
+		return "", fmt.Errorf("invalid schema: %w", err)
+	}
+	return string(data), nil
+}
+
+// SchemaErrorBody builds the error response for failed schema validation. In
+// the configured shape, a value of exactly "{{errors}}" becomes the list of
+// errors and "{{message}}" is replaced by a one-line summary. Without a shape
+// a default {"error": ..., "details": [...]} body is returned.
+func SchemaErrorBody(shape map[string]interface{}, errs []string) map[string]interface{} {
+	message := "request body does not match schema: " + strings.Join(errs, "; ")
+	if len(shape) == 0 {
+		return map[string]interface{}{
+			"error":   "request body does not match schema",
+			"details": errs,
+		}
+	}
+	return fillSchemaErrors(shape, errs, message).(map[string]interface{})
+}
+
+func fillSchemaErrors(data interface{}, errs []string, message string) interface{} {
+	switch v := data.(type) {
+	case string:
+		if v == "{{errors}}" {
+			return errs
+		}
+		v = strings.ReplaceAll(v, "{{errors}}", strings.Join(errs, "; "))
+		return strings.ReplaceAll(v, "{{message}}", message)
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			result[key] = fillSchemaErrors(val, errs, message)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = fillSchemaErrors(val, errs, message)
+		}
+		return result
+	}
+	return data
+}
+
+// loadSchema parses and caches a schema from inline JSON or a file
+func loadSchema(source string) (*openapi3.Schema, error) {
+	data := []byte(strings.TrimSpace(source))
+	var entry cachedSchema
+	if !strings.HasPrefix(string(data), "{") {
+		info, err := os.Stat(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema %q: %w", source, err)
+		}
+		entry.modTime, entry.size = info.ModTime(), info.Size()
+	}
+	if v, ok := schemaCache.Load(source); ok {
+		cached := v.(cachedSchema)
+		if cached.modTime.Equal(entry.modTime) && cached.size == entry.size {
+			return cached.schema, nil
+		}
+	}
+
+	if !strings.HasPrefix(string(data), "{") {
+		var err error
+		data, err = os.ReadFile(source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read schema %q: %w", source, err)
+		}
+		if ext := strings.ToLower(filepath.Ext(source)); ext == ".yaml" || ext == ".yml" {
+			var doc interface{}
+			if err := yaml.Unmarshal(data, &doc); err != nil {
+				return nil, fmt.Errorf("invalid schema %q: %w", source, err)
+			}
+			if data, err = json.Marshal(doc); err != nil {
+				return nil, fmt.Errorf("invalid schema %q: %w", source, err)
+			}
+		}
+	}
+
+	schema := &openapi3.Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	entry.schema = schema
+	schemaCache.Store(source, entry)
+	return schema, nil
+}
+
+// schemaErrorMessages flattens schema validation errors into readable lines
+// prefixed with the JSON pointer of the offending value
+func schemaErrorMessages(err error) []string {
+	return schemaErrorMessagesSkipping(err, nil)
+}
+
+// schemaErrorMessagesSkipping is like schemaErrorMessages but leaves out
+// errors for the values at the given JSON pointers
+func schemaErrorMessagesSkipping(err error, skip map[string]bool) []string {
+	var multi openapi3.MultiError
+	if errors.As(err, &multi) {
+		var messages []string
+		for _, e := range multi {
+			messages = append(messages, schemaErrorMessagesSkipping(e, skip)...)
+		}
+		return messages
+	}
+
+	var schemaErr *openapi3.SchemaError
+	if errors.As(err, &schemaErr) {
+		pointer := "/" + strings.Join(schemaErr.JSONPointer(), "/")
+		if skip[pointer] {
+			return nil
+		}
+		reason := schemaErr.Reason
+		if reason == "" && schemaErr.Origin != nil {
+			reason = schemaErr.Origin.Error()
+		}
+		return []string{pointer + ": " + reason}
+	}
+	return []string{err.Error()}
+}
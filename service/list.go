@@ -0,0 +1,365 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopher-mock/model"
+)
+
+// listParams are the query parameters that control paging, sorting and
+// searching rather than filter items
+var listParams = map[string]bool{
+	"offset": true, "limit": true, "page": true, "size": true,
+	"cursor": true, "sort": true, "q": true,
+}
+
+var filterSuffixes = []string{"_gte", "_lte", "_ne", "_like"}
+
+// ApplyList filters, sorts and pages the list in a rendered body. The list is
+// the body itself when it is an array, or its ItemsField. The page comes back
+// with metadata in a "meta" field, or in headers for the "link" style.
+// baseURL is the request URL without the query, used to build Link headers.
+// Bodies without a list are returned unchanged.
+func ApplyList(cfg model.ListConfig, body interface{}, query map[string]string, baseURL string) (interface{}, map[string]string) {
+	itemsField := cfg.ItemsField
+	if itemsField == "" {
+		itemsField = "data"
+	}
+
+	var items []interface{}
+	var envelope map[string]interface{}
+	switch v := body.(type) {
+	case []interface{}:
+		items = v
+		if cfg.Style != "link" {
+			envelope = map[string]interface{}{}
+		}
+	case map[string]interface{}:
+		list, ok := v[itemsField].([]interface{})
+		if !ok {
+			return body, nil
+		}
+		items = list
+		envelope = make(map[string]interface{}, len(v)+1)
+		for k, child := range v {
+			envelope[k] = child
+		}
+	default:
+		return body, nil
+	}
+
+	items = filterItems(items, cfg.Filters, query)
+	sortItems(items, query["sort"])
+	total := len(items)
+	headers := map[string]string{"X-Total-Count": strconv.Itoa(total)}
+
+	var page []interface{}
+	var meta map[string]interface{}
+	switch cfg.Style {
+	case "page", "link":
+		size := pageSize(cfg, query["size"])
+		number, _ := strconv.Atoi(query["page"])
+		if number < 1 {
+			number = 1
+		}
+		// Pages past the end are empty; clamping keeps the offset from overflowing
+		pages := (total + size - 1) / size
+		if number > pages+1 {
+			number = pages + 1
+		}
+		page = pageOf(items, (number-1)*size, size)
+		if cfg.Style == "link" {
+			headers["Link"] = linkHeader(baseURL, query, number, size, pages)
+		} else {
+			meta = map[string]interface{}{"total": total, "page": number, "size": size, "totalPages": pages}
+		}
+	case "cursor":
+		size := pageSize(cfg, query["limit"])
+		start := decodeCursor(query["cursor"])
+		page = pageOf(items, start, size)
+		meta = map[string]interface{}{"total": total, "limit": size, "hasMore": false, "nextCursor": nil}
+		if next := start + len(page); next < total {
+			meta["hasMore"] = true
+			meta["nextCursor"] = encodeCursor(next)
+		}
+	default:
+		size := pageSize(cfg, query["limit"])
+		offset, _ := strconv.Atoi(query["offset"])
+		if offset < 0 {
+			offset = 0
+		}
+		page = pageOf(items, offset, size)
+		meta = map[string]interface{}{"total": total, "offset": offset, "limit": size}
+	}
+
+	if envelope == nil {
+		return page, headers
+	}
+	envelope[itemsField] = page
+	if meta != nil {
+		envelope["meta"] = meta
+	}
+	return envelope, headers
+}
+
+// pageSize reads the requested page size, falling back to the default and
+// capping it at the maximum
+func pageSize(cfg model.ListConfig, value string) int {
+	max := cfg.MaxSize
+	if max <= 0 {
+		max = 100
+	}
+	size, err := strconv.Atoi(value)
+	if err != nil || size <= 0 {
+		size = cfg.DefaultSize
+		if size <= 0 {
+			size = 10
+		}
+	}
+	if size > max {
+		size = max
+	}
+	return size
+}
+
+func pageOf(items []interface{}, start, size int) []interface{} {
+	if start < 0 || start >= len(items) {
+		return []interface{}{}
+	}
+	end := start + size
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[start:end]
+}
+
+// Cursors are opaque to clients but simply encode the offset of the next item
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) int {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0
+	}
+	offset, err := strconv.Atoi(string(data))
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+// linkHeader builds an RFC 8288 Link header with first, prev, next and last
+// pages, keeping the other query parameters
+func linkHeader(baseURL string, query map[string]string, page, size, pages int) string {
+	if pages < 1 {
+		pages = 1
+	}
+	link := func(n int, rel string) string {
+		values := url.Values{}
+		for k, v := range query {
+			values.Set(k, v)
+		}
+		values.Set("page", strconv.Itoa(n))
+		values.Set("size", strconv.Itoa(size))
+		return fmt.Sprintf(`<%s?%s>; rel="%s"`, baseURL, values.Encode(), rel)
+	}
+
+	links := []string{link(1, "first")}
+	if page > 1 {
+		links = append(links, link(page-1, "prev"))
+	}
+	if page < pages {
+		links = append(links, link(page+1, "next"))
+	}
+	links = append(links, link(pages, "last"))
+	return strings.Join(links, ", ")
+}
+
+type itemFilter struct {
+	field, op, value string
+}
+
+// filterItems keeps the items matching every filter in the query and the
+// ?q= search. Without an allow list, only parameters named after a field of
+// some item filter, so unrelated parameters do not empty the list.
+func filterItems(items []interface{}, allowed []string, query map[string]string) []interface{} {
+	var filters []itemFilter
+	for key, value := range query {
+		if listParams[key] {
+			continue
+		}
+		field, op := key, "eq"
+		for _, suffix := range filterSuffixes {
+			if strings.HasSuffix(key, suffix) {
+				field, op = strings.TrimSuffix(key, suffix), suffix[1:]
+				break
+			}
+		}
+		if isFilterable(items, allowed, field) {
+			filters = append(filters, itemFilter{field, op, value})
+		}
+	}
+	search := strings.ToLower(query["q"])
+
+	result := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		if search != "" && !itemContains(item, search) {
+			continue
+		}
+		matched := true
+		for _, f := range filters {
+			if !f.matches(item) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func isFilterable(items []interface{}, allowed []string, field string) bool {
+	if len(allowed) > 0 {
+		for _, name := range allowed {
+			if name == field {
+				return true
+			}
+		}
+		return false
+	}
+	for _, item := range items {
+		if _, ok := itemValue(item, field); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matches checks an item against the filter. Equality accepts a comma
+// separated list of values; gte and lte compare numbers numerically and
+// anything else, such as ISO dates, as strings.
+func (f itemFilter) matches(item interface{}) bool {
+	value, ok := itemValue(item, f.field)
+	if !ok {
+		return f.op == "ne"
+	}
+	actual := stringifyValue(value)
+	switch f.op {
+	case "ne":
+		return actual != f.value
+	case "like":
+		return strings.Contains(strings.ToLower(actual), strings.ToLower(f.value))
+	case "gte", "lte":
+		var cmp int
+		a, errA := strconv.ParseFloat(actual, 64)
+		b, errB := strconv.ParseFloat(f.value, 64)
+		if errA == nil && errB == nil {
+			cmp = compareFloats(a, b)
+		} else {
+			cmp = strings.Compare(actual, f.value)
+		}
+		if f.op == "gte" {
+			return cmp >= 0
+		}
+		return cmp <= 0
+	}
+	for _, v := range strings.Split(f.value, ",") {
+		if actual == v {
+			return true
+		}
+	}
+	return false
+}
+
+// itemContains reports whether any top-level value of the item contains the
+// lowercase search text
+func itemContains(item interface{}, search string) bool {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return strings.Contains(strings.ToLower(stringifyValue(item)), search)
+	}
+	for _, v := range m {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		if strings.Contains(strings.ToLower(stringifyValue(v)), search) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortItems sorts by a list like "-age,name", where "-" sorts descending.
+// Items missing a field come last.
+func sortItems(items []interface{}, spec string) {
+	if spec == "" {
+		return
+	}
+	fields := strings.Split(spec, ",")
+	sort.SliceStable(items, func(i, j int) bool {
+		for _, field := range fields {
+			field = strings.TrimSpace(field)
+			desc := strings.HasPrefix(field, "-")
+			field = strings.TrimPrefix(field, "-")
+			a, okA := itemValue(items[i], field)
+			b, okB := itemValue(items[j], field)
+			if !okA || !okB {
+				if okA != okB {
+					return okA
+				}
+				continue
+			}
+			cmp := compareItemValues(a, b)
+			if cmp == 0 {
+				continue
+			}
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+func compareItemValues(a, b interface{}) int {
+	x, okA := numberValue(a)
+	y, okB := numberValue(b)
+	if okA && okB {
+		return compareFloats(x, y)
+	}
+	return strings.Compare(stringifyValue(a), stringifyValue(b))
+}
+
+func numberValue(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// itemValue reads a field of an item, which may be a path such as
+// "address.city"
+func itemValue(item interface{}, field string) (interface{}, bool) {
+	if m, ok := item.(map[string]interface{}); ok {
+		if v, ok := m[field]; ok {
+			return v, true
+		}
+	}
+	return LookupPath(item, field)
+}
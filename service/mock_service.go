@@ -1,103 +1,191 @@
 package service
 
 import (
-	"fmt"
 	"regexp"
+	"sort"
+	"strconv"
 	"strings"
-
-	"github.com/brianvoe/gofakeit/v6"
 )
 
-var fakerRegex = regexp.MustCompile(`\{\{faker\.([a-zA-Z0-9_]+)\}\}`)
-var templateRegex = regexp.MustCompile(`\{\{(body|header|query|path)\.([a-zA-Z0-9_-]+)\}\}`)
-
-var fakerMap = map[string]func() string{
-	"name":          gofakeit.Name,
-	"first_name":    gofakeit.FirstName,
-	"last_name":     gofakeit.LastName,
-	"email":         gofakeit.Email,
-	"phone":         gofakeit.Phone,
-	"company":       gofakeit.Company,
-	"address":       func() string { return gofakeit.Address().Address },
-	"city":          gofakeit.City,
-	"country":       gofakeit.Country,
-	"uuid":          gofakeit.UUID,
-	"word":          gofakeit.Word,
-	"sentence":      func() string { return gofakeit.Sentence(5) },
-	"paragraph":     func() string { return gofakeit.Paragraph(1, 2, 5, " ") },
-	"ipv4":          gofakeit.IPv4Address,
-	"user_agent":    gofakeit.UserAgent,
-	"number":        func() string { return fmt.Sprintf("%d", gofakeit.Number(1, 1000)) },
-	"boolean":       func() string { return fmt.Sprintf("%t", gofakeit.Bool()) },
-	"date":          func() string { return gofakeit.Date().Format("2006-01-02") },
-	"time":          func() string { return gofakeit.Date().Format("15:04:05") },
-	"hex_color":     gofakeit.HexColor,
-	"currency_code": func() string { return gofakeit.Currency().Short },
-}
+var templateRegex = regexp.MustCompile(`\{\{(body|header|query|path)\.([a-zA-Z0-9_\-.\[\]$]+)\}\}`)
 
 // RenderTemplateRecursive ...
 func RenderTemplateRecursive(data interface{}, bodyMap, headerMap, queryMap, pathMap map[string]string) interface{} {
+	return RenderTemplate(data, RequestContext{
+		Body:       bodyMap,
+		Headers:    headerMap,
+		Query:      queryMap,
+		PathParams: pathMap,
+	})
+}
+
+// RenderTemplate replaces request and faker placeholders in data using the
+// request context. Body placeholders accept nested paths such as
+// {{body.user.name}} or {{body.items[0].sku}}. Strings are also rendered as
+// Go templates, e.g. {{if eq .query.mode "full"}}...{{end}}. A string made
+// of a single placeholder is replaced by a value of the matching JSON type,
+// so "{{body.age}}" renders 42 rather than "42".
+func RenderTemplate(data interface{}, ctx RequestContext) interface{} {
+	ctx = ctx.beginRender()
 	switch v := data.(type) {
 	case string:
-		v = templateRegex.ReplaceAllStringFunc(v, func(m string) string {
-			match := templateRegex.FindStringSubmatch(m)
-			if len(match) > 2 {
-				source := match[1]
-				key := match[2]
-				switch source {
-				case "body":
-					if val, ok := bodyMap[key]; ok {
-						return val
-					}
-				case "header":
-					if val, ok := headerMap[key]; ok {
-						return val
-					}
-				case "query":
-					if val, ok := queryMap[key]; ok {
-						return val
-					}
-				case "path":
-					if val, ok := pathMap[key]; ok {
-						return val
-					}
-				}
-			}
-			return m
-		})
-
-		// Replace faker placeholders
-		v = fakerRegex.ReplaceAllStringFunc(v, func(m string) string {
-			match := fakerRegex.FindStringSubmatch(m)
-			if len(match) > 1 {
-				key := strings.ToLower(match[1])
-				if fn, ok := fakerMap[key]; ok {
-					return fn()
-				}
-			}
-			return m
-		})
+		// A value that is a single placeholder keeps the type of what it refers to
+		if val, ok := renderSolePlaceholder(v, ctx); ok {
+			return val
+		}
 
-		return v
+		if !strings.Contains(v, "{{") {
+			return v
+		}
+		// The template is parsed from the config string alone: placeholders
+		// are resolved while it executes, so request values are never parsed
+		if out, ok := renderTextTemplate(wrapPlaceholders(v), ctx); ok {
+			return out
+		}
+		return replacePlaceholders(v, ctx)
 	case map[string]interface{}:
-		result := make(map[string]interface{})
-		for key, val := range v {
-			result[key] = RenderTemplateRecursive(val, bodyMap, headerMap, queryMap, pathMap)
+		if isRepeatDirective(v) {
+			return renderRepeat(v, ctx)
+		}
+		// Keys are rendered in order so seeded faker values are reproducible
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		result := make(map[string]interface{}, len(v))
+		for _, key := range keys {
+			result[key] = RenderTemplate(v[key], ctx)
 		}
 		return result
 	case []interface{}:
-		for i, val := range v {
-			v[i] = RenderTemplateRecursive(val, bodyMap, headerMap, queryMap, pathMap)
+		result := make([]interface{}, 0, len(v))
+		for _, val := range v {
+			// Repeat directives inside arrays are expanded in place
+			if m, ok := val.(map[string]interface{}); ok && isRepeatDirective(m) {
+				result = append(result, renderRepeat(m, ctx)...)
+				continue
+			}
+			result = append(result, RenderTemplate(val, ctx))
 		}
+		return result
 	}
 	return data
 }
 
+// beginRender starts the repeat budget of a render and reads the request
+// values templates see once for all of its strings, unless ctx is already
+// part of a render
+func (ctx RequestContext) beginRender() RequestContext {
+	if ctx.repeats == nil {
+		budget := maxRenderRepeat
+		ctx.repeats = &budget
+	}
+	if ctx.data == nil {
+		ctx.data = requestData(ctx)
+	}
+	return ctx
+}
+
+// replacePlaceholders substitutes request and faker placeholders in a string
+// that is not a valid template
+func replacePlaceholders(v string, ctx RequestContext) string {
+	v = fakerRegex.ReplaceAllStringFunc(v, func(m string) string {
+		return resolvePlaceholder(m, ctx)
+	})
+	return templateRegex.ReplaceAllStringFunc(v, func(m string) string {
+		return resolvePlaceholder(m, ctx)
+	})
+}
+
+// resolvePlaceholder returns the value of a single request or faker
+// placeholder, or the placeholder itself when there is none
+func resolvePlaceholder(m string, ctx RequestContext) string {
+	if match := fakerRegex.FindStringSubmatch(m); match != nil {
+		if val, ok := renderFaker(ctx.faker(), match); ok {
+			return stringifyValue(val)
+		}
+		return m
+	}
+	match := templateRegex.FindStringSubmatch(m)
+	if len(match) < 3 {
+		return m
+	}
+	key := match[2]
+	switch match[1] {
+	case "body":
+		if val, ok := ctx.bodyValue(key); ok {
+			return val
+		}
+	case "header":
+		if val, ok := ctx.Headers[key]; ok {
+			return val
+		}
+	case "query":
+		if val, ok := ctx.Query[key]; ok {
+			return val
+		}
+	case "path":
+		if val, ok := ctx.PathParams[key]; ok {
+			return val
+		}
+	}
+	return m
+}
+
+// renderSolePlaceholder renders strings that consist of exactly one
+// placeholder into typed values: body fields and {{body}} keep their JSON
+// type, faker numbers and booleans are not quoted and single template actions
+// such as {{add 1 2}} or {{.body.items}} return the value they evaluate to
+func renderSolePlaceholder(v string, ctx RequestContext) (interface{}, bool) {
+	if !strings.HasPrefix(v, "{{") || !strings.HasSuffix(v, "}}") {
+		return nil, false
+	}
+
+	if v == "{{body}}" && ctx.BodyData != nil {
+		return ctx.BodyData, true
+	}
+	if m := templateRegex.FindStringSubmatch(v); m != nil && m[0] == v {
+		if m[1] == "body" {
+			return ctx.bodyRaw(m[2])
+		}
+		return nil, false
+	}
+	if m := fakerRegex.FindStringSubmatch(v); m != nil && m[0] == v {
+		return renderFaker(ctx.faker(), m)
+	}
+	return renderTemplateValue(v, ctx)
+}
+
+// RenderHeaders renders the templates in header values
+func RenderHeaders(headers map[string]string, ctx RequestContext) map[string]string {
+	result := make(map[string]string, len(headers))
+	for k, v := range headers {
+		result[k] = stringifyValue(RenderTemplate(v, ctx))
+	}
+	return result
+}
+
+// RenderStatusCode renders a status code template such as "{{query.status}}".
+// The fallback is returned when the template is empty or does not produce a
+// status between 100 and 599.
+func RenderStatusCode(tmpl string, fallback int, ctx RequestContext) int {
+	if tmpl == "" {
+		return fallback
+	}
+	code, err := strconv.Atoi(strings.TrimSpace(stringifyValue(RenderTemplate(tmpl, ctx))))
+	if err != nil || code < 100 || code > 599 {
+		return fallback
+	}
+	return code
+}
+
 // MapToStringMap ...
 func MapToStringMap(input map[string]interface{}) map[string]string {
 	output := make(map[string]string)
 	for k, v := range input {
-		output[k] = fmt.Sprintf("%v", v)
+		output[k] = stringifyValue(v)
 	}
 	return output
 }
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/getkin/kin-openapi/openapi2"
+	"github.com/getkin/kin-openapi/openapi2conv"
 	"github.com/getkin/kin-openapi/openapi3"
 	"gopkg.in/yaml.v3"
 
@@ -46,6 +48,15 @@ func ParseOpenAPISpec(data []byte, isYAML bool) ([]model.MockConfig, error) {
 			// Extract all responses and convert to conditional responses
 			conditionalResponses, defaultResp := extractAllResponses(operation)
 
+			// Mocks without conditional responses are served from the
+			// legacy fields, so they mirror the default response
+			responseBody := make(map[string]interface{})
+			statusCode := 200
+			if len(conditionalResponses) == 0 {
+				responseBody = defaultResp.Body
+				statusCode = defaultResp.StatusCode
+			}
+
 			config := model.MockConfig{
 				Name:            generateConfigName(operation, method, path),
 				Method:          strings.ToUpper(method),
@@ -53,11 +64,12 @@ func ParseOpenAPISpec(data []byte, isYAML bool) ([]model.MockConfig, error) {
 				RequestHeaders:  extractRequestHeaders(operation),
 				RequestBody:     extractRequestBody(operation),
 				ResponseHeaders: make(map[string]string),
-				ResponseBody:    make(map[string]interface{}),
-				StatusCode:      200,
+				ResponseBody:    responseBody,
+				StatusCode:      statusCode,
 				Timeout:         0,
 				Responses:       conditionalResponses,
 				DefaultResponse: defaultResp,
+				Spec:            &model.SpecBinding{Path: path},
 			}
 
 			configs = append(configs, config)
@@ -400,6 +412,8 @@ func generateExampleFromSchema(schema *openapi3.Schema) map[string]interface{} {
 				result[propName] = propSchema.Example
 			} else if propSchema.Default != nil {
 				result[propName] = propSchema.Default
+			} else if propSchema.Min != nil && *propSchema.Min > 0 {
+				result[propName] = *propSchema.Min
 			} else {
 				result[propName] = 0
 			}
@@ -484,6 +498,34 @@ func statusCodeToInt(code string) int {
 	}
 }
 
+// ConvertSwagger2 converts a Swagger 2.0 specification to an OpenAPI 3.0
+// document in JSON, so it can be imported and validated like one
+func ConvertSwagger2(data []byte, isYAML bool) ([]byte, error) {
+	if isYAML {
+		var doc interface{}
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse Swagger spec: %w", err)
+		}
+		var err error
+		if data, err = json.Marshal(doc); err != nil {
+			return nil, fmt.Errorf("failed to parse Swagger spec: %w", err)
+		}
+	}
+
+	var doc2 openapi2.T
+	if err := json.Unmarshal(data, &doc2); err != nil {
+		return nil, fmt.Errorf("failed to parse Swagger spec: %w", err)
+	}
+	if !strings.HasPrefix(doc2.Swagger, "2.") {
+		return nil, fmt.Errorf("not a valid Swagger 2.0 specification")
+	}
+	doc3, err := openapi2conv.ToV3(&doc2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert Swagger spec: %w", err)
+	}
+	return json.Marshal(doc3)
+}
+
 // ParseSwagger2Spec parses a Swagger 2.0 specification
 // This is a simplified version that converts Swagger 2.0 to basic mock configs
 func ParseSwagger2Spec(data []byte, isYAML bool) ([]model.MockConfig, error) {
@@ -0,0 +1,285 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+
+	"gopher-mock/model"
+)
+
+// SpecStore keeps imported OpenAPI specs on disk and caches the parsed
+// documents. Specs are stored as <id>.json or <id>.yaml, where the ID is
+// derived from the spec content.
+type SpecStore struct {
+	Dir  string
+	docs sync.Map
+}
+
+// NewSpecStore creates a store for the specs in dir
+func NewSpecStore(dir string) *SpecStore {
+	return &SpecStore{Dir: dir}
+}
+
+// SpecViolation describes why a request does not conform to its spec
+type SpecViolation struct {
+	Status int // 415 for unsupported content types, 400 otherwise
+	Errors []string
+}
+
+// SpecID returns the ID Save stores a spec under
+func SpecID(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Save stores a spec and returns its ID. Importing the same spec twice
+// reuses the stored file.
+func (s *SpecStore) Save(data []byte, isYAML bool) (string, error) {
+	id := SpecID(data)
+
+	ext := ".json"
+	if isYAML {
+		ext = ".yaml"
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create spec directory: %w", err)
+	}
+	path := filepath.Join(s.Dir, id+ext)
+	if _, err := os.Stat(path); err == nil {
+		return id, nil
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return "", fmt.Errorf("failed to save spec: %w", err)
+	}
+	return id, nil
+}
+
+// Load returns the parsed spec with the given ID
+func (s *SpecStore) Load(id string) (*openapi3.T, error) {
+	if v, ok := s.docs.Load(id); ok {
+		return v.(*openapi3.T), nil
+	}
+
+	var data []byte
+	var err error
+	for _, ext := range []string{".json", ".yaml"} {
+		if data, err = os.ReadFile(filepath.Join(s.Dir, id+ext)); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("spec %q not found in %s", id, s.Dir)
+	}
+
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse spec %q: %w", id, err)
+	}
+	s.docs.Store(id, doc)
+	return doc, nil
+}
+
+// operation finds the spec operation a mock is bound to
+func (s *SpecStore) operation(binding model.SpecBinding, method string) (*openapi3.T, *openapi3.PathItem, *openapi3.Operation, error) {
+	doc, err := s.Load(binding.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pathItem := doc.Paths.Value(binding.Path)
+	if pathItem == nil {
+		return nil, nil, nil, fmt.Errorf("path %q not found in spec %q", binding.Path, binding.ID)
+	}
+	op := pathItem.GetOperation(strings.ToUpper(method))
+	if op == nil {
+		return nil, nil, nil, fmt.Errorf("operation %s %s not found in spec %q", method, binding.Path, binding.ID)
+	}
+	return doc, pathItem, op, nil
+}
+
+// ValidateRequest checks parameters, content type and body of a request
+// against the operation the mock is bound to. It returns nil when the
+// request conforms, and an error when the spec cannot be used.
+func (s *SpecStore) ValidateRequest(binding model.SpecBinding, req *http.Request, pathParams map[string]string) (*SpecViolation, error) {
+	doc, pathItem, op, err := s.operation(binding, req.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: pathParams,
+		Route: &routers.Route{
+			Spec:      doc,
+			Path:      binding.Path,
+			PathItem:  pathItem,
+			Method:    req.Method,
+			Operation: op,
+		},
+		Options: &openapi3filter.Options{
+			MultiError:         true,
+			AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+		},
+	}
+	// A body the operation has no media type for is answered with 415
+	unsupported := unsupportedMediaType(op, req)
+	err = openapi3filter.ValidateRequest(context.Background(), input)
+	if err == nil {
+		return nil, nil
+	}
+
+	violation := &SpecViolation{Status: 400}
+	if unsupported {
+		violation.Status = 415
+	}
+	for _, e := range flattenErrors(err) {
+		violation.Errors = append(violation.Errors, e.Error())
+	}
+	return violation, nil
+}
+
+// unsupportedMediaType reports whether the request has a body in a content
+// type the operation does not accept
+func unsupportedMediaType(op *openapi3.Operation, req *http.Request) bool {
+	if op.RequestBody == nil || op.RequestBody.Value == nil || req.ContentLength == 0 {
+		return false
+	}
+	content := op.RequestBody.Value.Content
+	return len(content) > 0 && content.Get(req.Header.Get("Content-Type")) == nil
+}
+
+// flattenErrors unpacks the multi errors returned by the validator
+func flattenErrors(err error) []error {
+	if multi, ok := err.(openapi3.MultiError); ok {
+		var errs []error
+		for _, e := range multi {
+			errs = append(errs, flattenErrors(e)...)
+		}
+		return errs
+	}
+	return []error{err}
+}
+
+// ValidateResponse checks a response status and JSON body against the
+// responses declared for the operation the mock is bound to
+func (s *SpecStore) ValidateResponse(binding model.SpecBinding, method string, status int, body interface{}) ([]string, error) {
+	_, _, op, err := s.operation(binding, method)
+	if err != nil {
+		return nil, err
+	}
+	return validateOperationResponse(op, status, body, nil), nil
+}
+
+// ValidateMockResponses checks every response of a spec-backed mock against
+// the spec. Values containing template placeholders are not checked, as
+// their type is only known once rendered.
+func (s *SpecStore) ValidateMockResponses(cfg model.MockConfig) ([]string, error) {
+	_, _, op, err := s.operation(*cfg.Spec, cfg.Method)
+	if err != nil {
+		return nil, err
+	}
+
+	type namedResponse struct {
+		name   string
+		status int
+		body   map[string]interface{}
+	}
+	var responses []namedResponse
+	for _, condResp := range cfg.Responses {
+		responses = append(responses, namedResponse{condResp.Name, condResp.Response.StatusCode, condResp.Response.Body})
+	}
+	if len(cfg.Responses) > 0 && cfg.DefaultResponse != nil {
+		responses = append(responses, namedResponse{"default response", cfg.DefaultResponse.StatusCode, cfg.DefaultResponse.Body})
+	}
+	if len(cfg.Responses) == 0 || cfg.DefaultResponse == nil {
+		// The legacy fields are used when no conditional response matches
+		// and there is no default response
+		responses = append(responses, namedResponse{"response", cfg.StatusCode, cfg.ResponseBody})
+	}
+
+	var problems []string
+	for _, resp := range responses {
+		skip := map[string]bool{}
+		templatedPointers(resp.body, "", skip)
+		for _, msg := range validateOperationResponse(op, resp.status, resp.body, skip) {
+			problems = append(problems, fmt.Sprintf("%s: %s", resp.name, msg))
+		}
+	}
+	return problems, nil
+}
+
+// validateOperationResponse checks status and body against the declared
+// responses of an operation, ignoring errors at the pointers in skip
+func validateOperationResponse(op *openapi3.Operation, status int, body interface{}, skip map[string]bool) []string {
+	if op.Responses == nil {
+		return nil
+	}
+	ref := op.Responses.Status(status)
+	if ref == nil {
+		ref = op.Responses.Value(strconv.Itoa(status/100) + "XX")
+	}
+	if ref == nil {
+		ref = op.Responses.Default()
+	}
+	if ref == nil || ref.Value == nil {
+		return []string{fmt.Sprintf("status %d is not declared in the spec", status)}
+	}
+
+	content := ref.Value.Content.Get("application/json")
+	if content == nil || content.Schema == nil || content.Schema.Value == nil {
+		return nil
+	}
+	// Mock bodies are objects, so top-level array responses cannot be checked
+	if content.Schema.Value.Type.Is("array") {
+		return nil
+	}
+
+	// Round trip through JSON so the body only holds JSON types
+	var value interface{}
+	data, err := json.Marshal(body)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	_ = json.Unmarshal(data, &value)
+
+	if err := content.Schema.Value.VisitJSON(value, openapi3.MultiErrors()); err != nil {
+		return schemaErrorMessagesSkipping(err, skip)
+	}
+	return nil
+}
+
+// templatedPointers collects the JSON pointers of string values that
+// contain template placeholders
+func templatedPointers(data interface{}, pointer string, out map[string]bool) {
+	switch v := data.(type) {
+	case string:
+		if strings.Contains(v, "{{") {
+			out[pointer] = true
+		}
+	case map[string]interface{}:
+		if isRepeatDirective(v) {
+			out[pointer] = true
+			return
+		}
+		for key, val := range v {
+			templatedPointers(val, pointer+"/"+key, out)
+		}
+	case []interface{}:
+		for i, val := range v {
+			templatedPointers(val, pointer+"/"+strconv.Itoa(i), out)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxRepeat caps the number of elements a $repeat directive generates
+const maxRepeat = 1000
+
+// maxRenderRepeat caps the elements generated by all $repeat directives and
+// seq calls of one render, so nesting them does not multiply maxRepeat
+const maxRenderRepeat = 10 * maxRepeat
+
+var repeatRangeRegex = regexp.MustCompile(`^(\d+)\s*-\s*(\d+)$`)
+
+// isRepeatDirective reports whether an object is a $repeat directive such as
+// {"$repeat": 10, "$template": {"id": "{{.index}}", "name": "{{faker.name}}"}}
+func isRepeatDirective(m map[string]interface{}) bool {
+	_, hasRepeat := m["$repeat"]
+	_, hasTemplate := m["$template"]
+	return hasRepeat && hasTemplate
+}
+
+// renderRepeat renders the $template element as many times as $repeat asks
+// for. $repeat is a number, a "min-max" range, {"min": 1, "max": 10}, a
+// template like "{{query.limit}}" or {"query": "limit", "default": 10, "max": 100}.
+// Inside the element, {{.index}} is the 0-based position and {{.count}} the
+// number of elements.
+func renderRepeat(directive map[string]interface{}, ctx RequestContext) []interface{} {
+	count := ctx.takeRepeats(repeatCount(directive["$repeat"], ctx))
+	items := make([]interface{}, count)
+	for i := range items {
+		itemCtx := ctx
+		itemCtx.Vars = make(map[string]interface{}, len(ctx.Vars)+2)
+		for k, v := range ctx.Vars {
+			itemCtx.Vars[k] = v
+		}
+		itemCtx.Vars["index"] = i
+		itemCtx.Vars["count"] = count
+		items[i] = RenderTemplate(directive["$template"], itemCtx)
+	}
+	return items
+}
+
+// takeRepeats takes up to n elements from the budget of the render and
+// returns how many may be generated
+func (ctx RequestContext) takeRepeats(n int) int {
+	if n < 0 {
+		return 0
+	}
+	if ctx.repeats == nil {
+		return n
+	}
+	if n > *ctx.repeats {
+		n = *ctx.repeats
+	}
+	*ctx.repeats -= n
+	return n
+}
+
+// repeatCount resolves a $repeat value to a number of elements. Values that
+// cannot be resolved produce an empty list.
+func repeatCount(spec interface{}, ctx RequestContext) int {
+	var count int
+	switch v := spec.(type) {
+	case float64:
+		count = int(v)
+	case int:
+		count = v
+	case string:
+		count = parseRepeatCount(stringifyValue(RenderTemplate(v, ctx)), ctx)
+	case map[string]interface{}:
+		if param, ok := v["query"].(string); ok {
+			value, found := ctx.Query[param]
+			if !found || value == "" {
+				count = repeatCount(v["default"], ctx)
+			} else {
+				count = parseRepeatCount(value, ctx)
+			}
+			if limit, ok := v["max"].(float64); ok && count > int(limit) {
+				count = int(limit)
+			}
+			break
+		}
+		min, _ := v["min"].(float64)
+		max, _ := v["max"].(float64)
+		count = randomBetween(int(min), int(max), ctx)
+	}
+
+	if count < 0 {
+		return 0
+	}
+	if count > maxRepeat {
+		return maxRepeat
+	}
+	return count
+}
+
+// parseRepeatCount reads "10" or a "5-10" range
+func parseRepeatCount(value string, ctx RequestContext) int {
+	value = strings.TrimSpace(value)
+	if m := repeatRangeRegex.FindStringSubmatch(value); m != nil {
+		min, _ := strconv.Atoi(m[1])
+		max, _ := strconv.Atoi(m[2])
+		return randomBetween(min, max, ctx)
+	}
+	count, _ := strconv.Atoi(value)
+	return count
+}
+
+func randomBetween(min, max int, ctx RequestContext) int {
+	if max < min {
+		min, max = max, min
+	}
+	return ctx.faker().Number(min, max)
+}
@@ -0,0 +1,330 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/brianvoe/gofakeit/v6"
+
+	"gopher-mock/model"
+)
+
+// maxCollections caps the collections kept for one mock. A mock at
+// "/users/:id/orders" has one per user; beyond the cap the oldest are dropped.
+const maxCollections = 100
+
+// ResourceStore keeps the items of CRUD resource mocks in memory. Each
+// collection is keyed by its request path, e.g. "/users" or
+// "/users/1/orders", and is loaded from the mock's data on first use.
+type ResourceStore struct {
+	mu          sync.Mutex
+	collections map[string]*collection
+	order       []string // paths of the collections, oldest first
+}
+
+// CollectionKey identifies a collection by the path of its mock, e.g.
+// "/users/:id/orders", and its request path, e.g. "/users/1/orders"
+type CollectionKey struct {
+	Mock string
+	Path string
+}
+
+type collection struct {
+	mock  string
+	items []map[string]interface{}
+}
+
+// NewResourceStore creates an empty store
+func NewResourceStore() *ResourceStore {
+	return &ResourceStore{collections: make(map[string]*collection)}
+}
+
+// ResourceIDField returns the name of the id field of a resource
+func ResourceIDField(cfg model.ResourceConfig) string {
+	if cfg.IDField == "" {
+		return "id"
+	}
+	return cfg.IDField
+}
+
+// List returns a copy of all items of a collection
+func (s *ResourceStore) List(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker) []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	result := make([]map[string]interface{}, len(items))
+	for i, item := range items {
+		result[i] = copyItem(item)
+	}
+	return result
+}
+
+// Get returns a copy of the item with the given id
+func (s *ResourceStore) Get(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker, id string) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	if i := indexOfItem(items, ResourceIDField(cfg), id); i >= 0 {
+		return copyItem(items[i]), true
+	}
+	return nil, false
+}
+
+// Create adds an item. An id is generated when the item has none: the next
+// number when the collection uses numeric ids, a UUID otherwise. It fails when
+// an item with the same id exists.
+func (s *ResourceStore) Create(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker, item map[string]interface{}) (map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	idField := ResourceIDField(cfg)
+	item = copyItem(item)
+	if id, ok := item[idField]; ok && id != nil {
+		if indexOfItem(items, idField, stringifyValue(id)) >= 0 {
+			return nil, fmt.Errorf("item with %s %v already exists", idField, stringifyValue(id))
+		}
+	} else {
+		item[idField] = nextID(items, idField, faker)
+	}
+
+	s.collections[key.Path].items = append(items, item)
+	return copyItem(item), nil
+}
+
+// Replace overwrites the item with the given id, keeping its id
+func (s *ResourceStore) Replace(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker, id string, item map[string]interface{}) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	idField := ResourceIDField(cfg)
+	i := indexOfItem(items, idField, id)
+	if i < 0 {
+		return nil, false
+	}
+	item = copyItem(item)
+	item[idField] = items[i][idField]
+	items[i] = item
+	return copyItem(item), true
+}
+
+// Patch merges fields into the item with the given id. Fields set to null
+// are removed, as in a JSON merge patch.
+func (s *ResourceStore) Patch(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker, id string, patch map[string]interface{}) (map[string]interface{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	idField := ResourceIDField(cfg)
+	i := indexOfItem(items, idField, id)
+	if i < 0 {
+		return nil, false
+	}
+	item := copyItem(items[i])
+	for k, v := range patch {
+		if k == idField {
+			continue
+		}
+		if v == nil {
+			delete(item, k)
+			continue
+		}
+		item[k] = v
+	}
+	items[i] = item
+	return copyItem(item), true
+}
+
+// Delete removes the item with the given id
+func (s *ResourceStore) Delete(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker, id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	items := s.load(key, cfg, faker)
+	i := indexOfItem(items, ResourceIDField(cfg), id)
+	if i < 0 {
+		return false
+	}
+	s.collections[key.Path].items = append(items[:i:i], items[i+1:]...)
+	return true
+}
+
+// Reset drops the collections starting with prefix, or all collections when
+// prefix is empty. They are reloaded from the mock data on next use.
+func (s *ResourceStore) Reset(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.drop(func(key string, _ *collection) bool {
+		return prefix == "" || key == prefix || (len(key) > len(prefix) && key[:len(prefix)] == prefix && key[len(prefix)] == '/')
+	})
+}
+
+// ResetMock drops the collections of the mock at the given path, so they are
+// reloaded from its data on next use
+func (s *ResourceStore) ResetMock(mock string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.drop(func(_ string, c *collection) bool {
+		return c.mock == mock
+	})
+}
+
+// drop removes the collections match selects and returns how many there
+// were. The caller must hold s.mu.
+func (s *ResourceStore) drop(match func(key string, c *collection) bool) int {
+	kept := s.order[:0]
+	for _, key := range s.order {
+		if match(key, s.collections[key]) {
+			delete(s.collections, key)
+			continue
+		}
+		kept = append(kept, key)
+	}
+	count := len(s.order) - len(kept)
+	s.order = kept
+	return count
+}
+
+// State returns the collections as the state expression rules and templates
+// see, e.g. size(state["/users"]) > 2. Collections are copied on first use and
+// the copy is kept, so a request sees one snapshot.
+func (s *ResourceStore) State() func() map[string]interface{} {
+	var once sync.Once
+	var state map[string]interface{}
+	return func() map[string]interface{} {
+		once.Do(func() {
+			collections := s.Export()
+			state = make(map[string]interface{}, len(collections))
+			for key, items := range collections {
+				list := make([]interface{}, len(items))
+				for i, item := range items {
+					list[i] = item
+				}
+				state[key] = list
+			}
+		})
+		return state
+	}
+}
+
+// Export returns a copy of all loaded collections
+func (s *ResourceStore) Export() map[string][]map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string][]map[string]interface{}, len(s.collections))
+	for key, c := range s.collections {
+		copied := make([]map[string]interface{}, len(c.items))
+		for i, item := range c.items {
+			copied[i] = copyItem(item)
+		}
+		result[key] = copied
+	}
+	return result
+}
+
+// load returns a collection, rendering the mock data on first use. Data may
+// use templates and $repeat directives, e.g. to generate 50 fake users.
+// The caller must hold s.mu.
+func (s *ResourceStore) load(key CollectionKey, cfg model.ResourceConfig, faker *gofakeit.Faker) []map[string]interface{} {
+	if c, ok := s.collections[key.Path]; ok {
+		return c.items
+	}
+
+	items := []map[string]interface{}{}
+	rendered, _ := RenderTemplate(cfg.Data, RequestContext{Faker: faker}).([]interface{})
+	for _, v := range rendered {
+		if item, ok := v.(map[string]interface{}); ok {
+			items = append(items, item)
+		}
+	}
+
+	// Items without an id get one, in order
+	idField := ResourceIDField(cfg)
+	for _, item := range items {
+		if _, ok := item[idField]; !ok {
+			item[idField] = nextID(items, idField, faker)
+		}
+	}
+
+	// The oldest collection of the mock makes room for the new one
+	count := 0
+	for _, c := range s.collections {
+		if c.mock == key.Mock {
+			count++
+		}
+	}
+	if count >= maxCollections {
+		dropped := false
+		s.drop(func(_ string, c *collection) bool {
+			if dropped || c.mock != key.Mock {
+				return false
+			}
+			dropped = true
+			return true
+		})
+	}
+	s.collections[key.Path] = &collection{mock: key.Mock, items: items}
+	s.order = append(s.order, key.Path)
+	return items
+}
+
+// nextID returns max+1 when all ids in the collection are numbers, and a
+// UUID otherwise
+func nextID(items []map[string]interface{}, idField string, faker *gofakeit.Faker) interface{} {
+	max := 0.0
+	for _, item := range items {
+		id, ok := item[idField]
+		if !ok {
+			continue
+		}
+		n, ok := numberValue(id)
+		if !ok {
+			if faker == nil {
+				faker = defaultFaker
+			}
+			return faker.UUID()
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max + 1
+}
+
+func indexOfItem(items []map[string]interface{}, idField, id string) int {
+	for i, item := range items {
+		if v, ok := item[idField]; ok && stringifyValue(v) == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// copyItem copies an item deeply enough that callers cannot change the store
+func copyItem(item map[string]interface{}) map[string]interface{} {
+	return copyValue(item).(map[string]interface{})
+}
+
+func copyValue(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(val))
+		for k, child := range val {
+			result[k] = copyValue(child)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(val))
+		for i, child := range val {
+			result[i] = copyValue(child)
+		}
+		return result
+	}
+	return v
+}
@@ -1,33 +1,134 @@
 package service
 
 import (
-	"regexp"
-	"strconv"
+	"errors"
+	"fmt"
+	"net"
 	"strings"
 	"sync"
 
+	"github.com/brianvoe/gofakeit/v6"
+
 	"gopher-mock/model"
 )
 
 // RequestContext holds the request data for rule evaluation
 type RequestContext struct {
-	Body       map[string]string
-	Headers    map[string]string
-	Query      map[string]string
-	PathParams map[string]string
+	Body        map[string]string
+	BodyData    interface{} // parsed request body, used for nested path lookups
+	Headers     map[string]string
+	Query       map[string]string
+	PathParams  map[string]string
+	Cookies     map[string]string
+	Form        map[string]string // urlencoded and multipart form fields
+	Method      string
+	RawBody     string
+	ClientIP    string
+	ContentType string
+	Host        string
+	State       func() map[string]interface{} // mock state for expressions and templates, read on first use
+	Vars        map[string]interface{}        // template variables, such as the $repeat index
+	Faker       *gofakeit.Faker               // seeded faker for this request, nil for random values
+
+	repeats *int                   // elements $repeat and seq may still generate in this render
+	data    map[string]interface{} // request values templates see in this render
+}
+
+// faker returns the faker used to render templates for the request
+func (ctx RequestContext) faker() *gofakeit.Faker {
+	if ctx.Faker != nil {
+		return ctx.Faker
+	}
+	return defaultFaker
+}
+
+// bodyValue resolves a field in the request body. Top-level keys are matched
+// first, so field names containing dots keep working; anything else is
+// resolved as a path into the parsed JSON body.
+func (ctx RequestContext) bodyValue(field string) (string, bool) {
+	if val, ok := ctx.Body[field]; ok {
+		return val, true
+	}
+	val, ok := ctx.bodyRaw(field)
+	if !ok {
+		return "", false
+	}
+	return stringifyValue(val), true
+}
+
+// bodyRaw is like bodyValue but returns the parsed JSON value
+func (ctx RequestContext) bodyRaw(field string) (interface{}, bool) {
+	if m, ok := ctx.BodyData.(map[string]interface{}); ok {
+		if val, ok := m[field]; ok {
+			return val, true
+		}
+	}
+	if ctx.BodyData != nil {
+		if val, ok := LookupPath(ctx.BodyData, field); ok {
+			return val, true
+		}
+	}
+	if val, ok := ctx.Body[field]; ok {
+		return val, true
+	}
+	return nil, false
+}
+
+// headerValue looks up a header by exact name first and falls back to a
+// case-insensitive match
+func (ctx RequestContext) headerValue(name string) string {
+	if val, ok := ctx.Headers[name]; ok {
+		return val
+	}
+	for k, v := range ctx.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+	return ""
+}
+
+// sourceValue reads a request value by source ("body", "header", "query",
+// "path", "cookie" or "form") and key
+func (ctx RequestContext) sourceValue(source, key string) string {
+	switch strings.ToLower(source) {
+	case "body":
+		val, _ := ctx.bodyValue(key)
+		return val
+	case "header":
+		return ctx.headerValue(key)
+	case "query":
+		return ctx.Query[key]
+	case "path":
+		return ctx.PathParams[key]
+	case "cookie":
+		return ctx.Cookies[key]
+	case "form":
+		return ctx.Form[key]
+	}
+	return ""
 }
 
 var regexCache sync.Map
 
-// EvaluateRules evaluates all rules with the given operator (AND/OR)
-func EvaluateRules(rules []model.Rule, operator string, ctx RequestContext) bool {
+// EvaluateRules evaluates all rules with the given operator (AND/OR). Rules
+// that cannot be evaluated, such as rules with an unknown operator in configs
+// loaded from disk, do not match. The returned error lists them so the caller
+// can log them; Save rejects such rules through ValidateConfigs.
+func EvaluateRules(rules []model.Rule, operator string, ctx RequestContext) (bool, error) {
+	var failures []error
+	matched := evaluateRules(rules, operator, ctx, &failures)
+	return matched, errors.Join(failures...)
+}
+
+func evaluateRules(rules []model.Rule, operator string, ctx RequestContext, failures *[]error) bool {
 	if len(rules) == 0 {
 		return true // No rules means always match
 	}
 
 	results := make([]bool, len(rules))
 	for i, rule := range rules {
-		results[i] = evaluateRule(rule, ctx)
+		results[i] = evaluateNode(rule, ctx, failures)
 	}
 
 	if strings.ToUpper(operator) == "OR" {
@@ -37,88 +138,163 @@ func EvaluateRules(rules []model.Rule, operator string, ctx RequestContext) bool
 	return allTrue(results)
 }
 
+// ValidateRules checks a rule tree for unknown targets and operators and for
+// comparison values that can never be evaluated
+func ValidateRules(rules []model.Rule) error {
+	for _, rule := range rules {
+		if isRuleGroup(rule) {
+			switch strings.ToUpper(rule.Combinator) {
+			case "", "AND", "OR":
+			default:
+				return fmt.Errorf("unknown combinator %q", rule.Combinator)
+			}
+			if err := ValidateRules(rule.Rules); err != nil {
+				return err
+			}
+			continue
+		}
+		if !knownTargets[strings.ToLower(rule.Target)] {
+			return fmt.Errorf("unknown rule target %q", rule.Target)
+		}
+		if strings.EqualFold(rule.Target, "expression") {
+			if _, err := CompileExpression(rule.Value); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := validateOperator(rule.Operator, rule.Value); err != nil {
+			return fmt.Errorf("rule on %s %q: %w", rule.Target, rule.Field, err)
+		}
+	}
+	return nil
+}
+
+// ValidateConfigs validates the request schemas and the rules of every
+// conditional response, and returns the first problem
+func ValidateConfigs(configs []model.MockConfig) error {
+	if errs := ConfigErrors(configs); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ConfigErrors lists the problems ValidateConfigs checks for, in all configs
+func ConfigErrors(configs []model.MockConfig) []error {
+	var errs []error
+	for i, cfg := range configs {
+		if cfg.RequestSchema != nil {
+			source, err := SchemaSource(*cfg.RequestSchema)
+			if err == nil {
+				_, err = loadSchema(source)
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("config #%d (%s), request schema: %w", i+1, cfg.Name, err))
+			}
+		}
+		for j, resp := range cfg.Responses {
+			if err := ValidateRules(resp.Rules); err != nil {
+				errs = append(errs, fmt.Errorf("config #%d (%s), response #%d (%s): %w", i+1, cfg.Name, j+1, resp.Name, err))
+			}
+		}
+	}
+	return errs
+}
+
+// evaluateNode evaluates a rule or a nested group and applies its negation.
+// A rule that fails to evaluate does not match, negated or not.
+func evaluateNode(rule model.Rule, ctx RequestContext, failures *[]error) bool {
+	if isRuleGroup(rule) {
+		return evaluateRules(rule.Rules, rule.Combinator, ctx, failures) != rule.Not
+	}
+	result, err := evaluateRule(rule, ctx)
+	if err != nil {
+		*failures = append(*failures, err)
+		return false
+	}
+	return result != rule.Not
+}
+
+// isRuleGroup reports whether the rule combines child rules instead of
+// checking a request value itself
+func isRuleGroup(rule model.Rule) bool {
+	return rule.Combinator != "" || len(rule.Rules) > 0
+}
+
+var knownTargets = map[string]bool{
+	"body": true, "header": true, "query": true, "path": true, "cookie": true, "form": true,
+	"method": true, "rawbody": true, "clientip": true, "contenttype": true, "host": true,
+	"expression": true,
+}
+
 // evaluateRule evaluates a single rule against the request context
-func evaluateRule(rule model.Rule, ctx RequestContext) bool {
+func evaluateRule(rule model.Rule, ctx RequestContext) (bool, error) {
 	var actualValue string
+	var rawValue interface{}
+	found := true
+
+	// Expression rules carry the whole condition in their value
+	if strings.EqualFold(rule.Target, "expression") {
+		return evaluateExpression(rule.Value, ctx)
+	}
 
 	// Get the actual value from the appropriate source
 	switch strings.ToLower(rule.Target) {
 	case "body":
-		actualValue = ctx.Body[rule.Field]
+		rawValue, found = ctx.bodyRaw(rule.Field)
+		actualValue, _ = ctx.bodyValue(rule.Field)
 	case "header":
-		actualValue = ctx.Headers[rule.Field]
+		actualValue = ctx.headerValue(rule.Field)
 	case "query":
-		actualValue = ctx.Query[rule.Field]
+		actualValue, found = ctx.Query[rule.Field]
 	case "path":
-		actualValue = ctx.PathParams[rule.Field]
+		actualValue, found = ctx.PathParams[rule.Field]
+	case "cookie":
+		actualValue, found = ctx.Cookies[rule.Field]
+	case "form":
+		actualValue, found = ctx.Form[rule.Field]
+	case "method":
+		actualValue = ctx.Method
+	case "rawbody":
+		actualValue = ctx.RawBody
+	case "clientip":
+		actualValue = ctx.ClientIP
+	case "contenttype":
+		actualValue = ctx.ContentType
+	case "host":
+		actualValue = ctx.Host
 	default:
-		return false
+		return false, fmt.Errorf("unknown rule target %q", rule.Target)
+	}
+	if rawValue == nil && found {
+		rawValue = actualValue
 	}
 
-	// Evaluate based on operator
-	switch strings.ToLower(rule.Operator) {
-	case "equals", "==":
-		return actualValue == rule.Value
-	case "not_equals", "!=":
-		return actualValue != rule.Value
-	case "contains", "~":
-		return strings.Contains(actualValue, rule.Value)
-	case "regex", ".*":
-		var re *regexp.Regexp
-		if v, ok := regexCache.Load(rule.Value); ok {
-			re = v.(*regexp.Regexp)
-		} else {
-			var err error
-			re, err = regexp.Compile(rule.Value)
-			if err != nil {
-				return false
-			}
-			regexCache.Store(rule.Value, re)
-		}
-		return re.MatchString(actualValue)
-	case "exists", "?":
-		// For exists, we check if the field has a non-empty value
-		// The rule.Value can be "true" or "false"
-		exists := actualValue != ""
-		expectedExists := strings.ToLower(rule.Value) != "false"
-		return exists == expectedExists
-	case "gt", ">":
-		// Greater than - try to parse as numbers
-		actual, err1 := strconv.ParseFloat(actualValue, 64)
-		expected, err2 := strconv.ParseFloat(rule.Value, 64)
-		if err1 != nil || err2 != nil {
-			// Fallback to string comparison
-			return actualValue > rule.Value
-		}
-		return actual > expected
-	case "lt", "<":
-		// Less than - try to parse as numbers
-		actual, err1 := strconv.ParseFloat(actualValue, 64)
-		expected, err2 := strconv.ParseFloat(rule.Value, 64)
-		if err1 != nil || err2 != nil {
-			// Fallback to string comparison
-			return actualValue < rule.Value
+	return applyOperator(rule.Operator, actualValue, rawValue, rule.Value)
+}
+
+// matchCIDR reports whether ip falls into any of the comma separated
+// CIDR ranges or equals any of the plain IPs in ranges
+func matchCIDR(ip, ranges string) bool {
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if addr == nil {
+		return false
+	}
+	for _, r := range strings.Split(ranges, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
 		}
-		return actual < expected
-	case "gte", ">=":
-		// Greater than or equal
-		actual, err1 := strconv.ParseFloat(actualValue, 64)
-		expected, err2 := strconv.ParseFloat(rule.Value, 64)
-		if err1 != nil || err2 != nil {
-			return actualValue >= rule.Value
+		if _, network, err := net.ParseCIDR(r); err == nil {
+			if network.Contains(addr) {
+				return true
+			}
+			continue
 		}
-		return actual >= expected
-	case "lte", "<=":
-		// Less than or equal
-		actual, err1 := strconv.ParseFloat(actualValue, 64)
-		expected, err2 := strconv.ParseFloat(rule.Value, 64)
-		if err1 != nil || err2 != nil {
-			return actualValue <= rule.Value
+		if other := net.ParseIP(r); other != nil && other.Equal(addr) {
+			return true
 		}
-		return actual <= expected
-	default:
-		return false
 	}
+	return false
 }
 
 // allTrue returns true if all values in the slice are true
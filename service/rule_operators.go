@@ -0,0 +1,359 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ciOperators lists the operators that accept a "_ci" suffix for
+// case-insensitive comparison, e.g. "equals_ci" or "starts_with_ci"
+var ciOperators = map[string]bool{
+	"equals": true, "not_equals": true, "contains": true, "not_contains": true,
+	"starts_with": true, "ends_with": true, "in": true, "not_in": true, "regex": true,
+}
+
+// operatorAliases maps the symbolic operator spellings to their names
+var operatorAliases = map[string]string{
+	"==": "equals",
+	"!=": "not_equals",
+	"~":  "contains",
+	"!~": "not_contains",
+	".*": "regex",
+	"?":  "exists",
+	">":  "gt",
+	"<":  "lt",
+	">=": "gte",
+	"<=": "lte",
+}
+
+// normalizeOperator lowercases the operator, resolves aliases and strips the
+// case-insensitive suffix
+func normalizeOperator(operator string) (string, bool) {
+	op := strings.ToLower(strings.TrimSpace(operator))
+	if alias, ok := operatorAliases[op]; ok {
+		op = alias
+	}
+	if base := strings.TrimSuffix(op, "_ci"); base != op && ciOperators[base] {
+		return base, true
+	}
+	return op, false
+}
+
+// applyOperator compares the actual request value against the rule value.
+// raw holds the parsed JSON value when available, so lengths of arrays and
+// objects can be measured. Errors are returned for unknown operators and for
+// rule values that cannot be interpreted.
+func applyOperator(operator, actual string, raw interface{}, expected string) (bool, error) {
+	op, ignoreCase := normalizeOperator(operator)
+	if ignoreCase && op != "regex" {
+		actual = strings.ToLower(actual)
+		expected = strings.ToLower(expected)
+	}
+
+	switch op {
+	case "equals":
+		return actual == expected, nil
+	case "not_equals":
+		return actual != expected, nil
+	case "contains":
+		return strings.Contains(actual, expected), nil
+	case "not_contains":
+		return !strings.Contains(actual, expected), nil
+	case "starts_with":
+		return strings.HasPrefix(actual, expected), nil
+	case "ends_with":
+		return strings.HasSuffix(actual, expected), nil
+	case "in", "not_in":
+		list, err := parseList(expected)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for _, item := range list {
+			if item == actual {
+				found = true
+				break
+			}
+		}
+		return found == (op == "in"), nil
+	case "regex":
+		pattern := expected
+		if ignoreCase {
+			pattern = "(?i)" + pattern
+		}
+		re, err := compileRegex(pattern)
+		if err != nil {
+			return false, err
+		}
+		return re.MatchString(actual), nil
+	case "exists":
+		// For exists, we check if the field has a non-empty value
+		// The rule.Value can be "true" or "false"
+		exists := actual != ""
+		expectedExists := strings.ToLower(expected) != "false"
+		return exists == expectedExists, nil
+	case "gt", "gte", "lt", "lte":
+		want, err := strconv.ParseFloat(expected, 64)
+		if err != nil {
+			return false, fmt.Errorf("operator %s needs a numeric value, got %q", op, expected)
+		}
+		got, err := strconv.ParseFloat(actual, 64)
+		if err != nil {
+			return false, nil
+		}
+		return compareOrdered(op, compareFloats(got, want)), nil
+	case "len_eq", "len_gt", "len_gte", "len_lt", "len_lte":
+		want, err := strconv.Atoi(expected)
+		if err != nil {
+			return false, fmt.Errorf("operator %s needs an integer value, got %q", op, expected)
+		}
+		return compareOrdered(strings.TrimPrefix(op, "len_"), compareFloats(float64(valueLength(raw, actual)), float64(want))), nil
+	case "before", "after":
+		want, err := parseTimeValue(expected, time.Now())
+		if err != nil {
+			return false, fmt.Errorf("operator %s: %w", op, err)
+		}
+		got, err := parseTimeValue(actual, time.Now())
+		if err != nil {
+			return false, nil
+		}
+		if op == "before" {
+			return got.Before(want), nil
+		}
+		return got.After(want), nil
+	case "semver_eq", "semver_gt", "semver_gte", "semver_lt", "semver_lte":
+		want, err := parseSemver(expected)
+		if err != nil {
+			return false, fmt.Errorf("operator %s: %w", op, err)
+		}
+		got, err := parseSemver(actual)
+		if err != nil {
+			return false, nil
+		}
+		return compareOrdered(strings.TrimPrefix(op, "semver_"), compareSemver(got, want)), nil
+	case "matches_schema", "not_matches_schema":
+		// Value is an inline JSON schema or the path of a schema file
+		value := raw
+		if str, ok := raw.(string); ok {
+			var decoded interface{}
+			if err := json.Unmarshal([]byte(str), &decoded); err == nil {
+				value = decoded
+			}
+		}
+		errs, err := ValidateJSONSchema(expected, value)
+		if err != nil {
+			return false, err
+		}
+		return (len(errs) == 0) == (op == "matches_schema"), nil
+	case "cidr", "in_cidr":
+		// Value is a comma separated list of CIDR ranges or plain IPs
+		return matchCIDR(actual, expected), nil
+	default:
+		return false, fmt.Errorf("unknown operator %q", operator)
+	}
+}
+
+// validateOperator reports the error applyOperator would return for the rule
+// value regardless of the request
+func validateOperator(operator, expected string) error {
+	_, err := applyOperator(operator, "", nil, expected)
+	return err
+}
+
+// compareOrdered turns a three-way comparison result into the outcome of
+// eq/gt/gte/lt/lte
+func compareOrdered(op string, cmp int) bool {
+	switch op {
+	case "eq":
+		return cmp == 0
+	case "gt":
+		return cmp > 0
+	case "gte":
+		return cmp >= 0
+	case "lt":
+		return cmp < 0
+	case "lte":
+		return cmp <= 0
+	}
+	return false
+}
+
+func compareFloats(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// compileRegex compiles a pattern once and caches it
+func compileRegex(pattern string) (*regexp.Regexp, error) {
+	if v, ok := regexCache.Load(pattern); ok {
+		return v.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex %q: %w", pattern, err)
+	}
+	regexCache.Store(pattern, re)
+	return re, nil
+}
+
+// parseList reads the value of in/not_in rules: either a JSON array or a
+// comma separated list
+func parseList(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if strings.HasPrefix(value, "[") {
+		var items []interface{}
+		if err := json.Unmarshal([]byte(value), &items); err != nil {
+			return nil, fmt.Errorf("invalid list %q: %w", value, err)
+		}
+		list := make([]string, len(items))
+		for i, item := range items {
+			list[i] = stringifyValue(item)
+		}
+		return list, nil
+	}
+
+	parts := strings.Split(value, ",")
+	list := make([]string, len(parts))
+	for i, part := range parts {
+		list[i] = strings.TrimSpace(part)
+	}
+	return list, nil
+}
+
+// valueLength measures arrays and objects by their number of entries and
+// everything else by its number of characters
+func valueLength(raw interface{}, actual string) int {
+	switch v := raw.(type) {
+	case []interface{}:
+		return len(v)
+	case map[string]interface{}:
+		return len(v)
+	}
+	return utf8.RuneCountInString(actual)
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+var relativeTimeRegex = regexp.MustCompile(`^now\s*(?:([+-])\s*(\d+)\s*([a-z]+))?$`)
+
+// parseTimeValue parses an ISO 8601 date or timestamp, a unix timestamp in
+// seconds, or a time relative to now such as "now", "now-1h" or "now+7d"
+func parseTimeValue(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+
+	if m := relativeTimeRegex.FindStringSubmatch(strings.ToLower(value)); m != nil {
+		if m[1] == "" {
+			return now, nil
+		}
+		amount, _ := strconv.Atoi(m[2])
+		unit, ok := map[string]time.Duration{
+			"s": time.Second, "m": time.Minute, "h": time.Hour,
+			"d": 24 * time.Hour, "w": 7 * 24 * time.Hour,
+		}[m[3]]
+		if !ok {
+			return time.Time{}, fmt.Errorf("unknown time unit %q in %q", m[3], value)
+		}
+		offset := time.Duration(amount) * unit
+		if m[1] == "-" {
+			offset = -offset
+		}
+		return now.Add(offset), nil
+	}
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Time{}, fmt.Errorf("invalid date/time %q", value)
+}
+
+// semver is a parsed semantic version
+type semver struct {
+	core       [3]int
+	prerelease []string
+}
+
+// parseSemver parses versions such as "1.2.3", "v2.0" or "1.0.0-beta.2+build.5".
+// Missing minor and patch numbers default to zero.
+func parseSemver(value string) (semver, error) {
+	var v semver
+	s := strings.TrimPrefix(strings.TrimSpace(value), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.prerelease = strings.Split(s[i+1:], ".")
+		s = s[:i]
+	}
+
+	parts := strings.Split(s, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return v, fmt.Errorf("invalid semantic version %q", value)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return v, fmt.Errorf("invalid semantic version %q", value)
+		}
+		v.core[i] = n
+	}
+	return v, nil
+}
+
+// compareSemver compares two versions following semver precedence rules
+func compareSemver(a, b semver) int {
+	for i := range a.core {
+		if a.core[i] != b.core[i] {
+			return compareFloats(float64(a.core[i]), float64(b.core[i]))
+		}
+	}
+
+	// A version without prerelease has higher precedence
+	switch {
+	case len(a.prerelease) == 0 && len(b.prerelease) == 0:
+		return 0
+	case len(a.prerelease) == 0:
+		return 1
+	case len(b.prerelease) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(a.prerelease) && i < len(b.prerelease); i++ {
+		x, y := a.prerelease[i], b.prerelease[i]
+		if x == y {
+			continue
+		}
+		xn, xErr := strconv.Atoi(x)
+		yn, yErr := strconv.Atoi(y)
+		switch {
+		case xErr == nil && yErr == nil:
+			return compareFloats(float64(xn), float64(yn))
+		case xErr == nil:
+			return -1 // numeric identifiers sort before alphanumeric ones
+		case yErr == nil:
+			return 1
+		default:
+			return strings.Compare(x, y)
+		}
+	}
+	return compareFloats(float64(len(a.prerelease)), float64(len(b.prerelease)))
+}
@@ -1,7 +1,16 @@
 package service
 
 import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
 	"testing"
+	"time"
+
+	"gopher-mock/model"
 )
 
 func TestRenderTemplateRecursive(t *testing.T) {
@@ -30,3 +39,585 @@ func TestRenderTemplateRecursive_NoMatch(t *testing.T) {
 		t.Errorf("Expected %s, got %s", expected, result)
 	}
 }
+
+func TestLookupPath(t *testing.T) {
+	var data interface{}
+	if err := json.Unmarshal([]byte(`{"user":{"address":{"city":"Jakarta"}},"items":[{"sku":"A1"},{"sku":"B2"}]}`), &data); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]interface{}{
+		"user.address.city": "Jakarta",
+		"items[1].sku":      "B2",
+		"$.items.0.sku":     "A1",
+		"items[-1].sku":     "B2",
+	}
+	for path, expected := range cases {
+		val, ok := LookupPath(data, path)
+		if !ok || val != expected {
+			t.Errorf("LookupPath(%q) = %v, %v; expected %v", path, val, ok, expected)
+		}
+	}
+
+	if _, ok := LookupPath(data, "items[5].sku"); ok {
+		t.Error("Expected out of range index to be missing")
+	}
+}
+
+func TestNestedBodyRulesAndTemplates(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"user":{"name":"Alice","age":30},"items":[{"sku":"A1"}]}`), &data)
+	ctx := RequestContext{
+		Body:     MapToStringMap(data.(map[string]interface{})),
+		BodyData: data,
+	}
+
+	rules := []model.Rule{
+		{Target: "body", Field: "user.name", Operator: "equals", Value: "Alice"},
+		{Target: "body", Field: "items[0].sku", Operator: "equals", Value: "A1"},
+		{Target: "body", Field: "user.age", Operator: "gt", Value: "18"},
+	}
+	if matched, err := EvaluateRules(rules, "AND", ctx); err != nil || !matched {
+		t.Errorf("Expected nested body rules to match, got %v (%v)", matched, err)
+	}
+
+	result := RenderTemplate("{{body.user.name}} bought {{body.items[0].sku}}", ctx)
+	if result.(string) != "Alice bought A1" {
+		t.Errorf("Unexpected render result: %s", result)
+	}
+
+	if ctx.Body["user"] != `{"age":30,"name":"Alice"}` {
+		t.Errorf("Expected nested objects to be flattened as JSON, got %s", ctx.Body["user"])
+	}
+}
+
+func TestEvaluateRules_Tree(t *testing.T) {
+	// (tier == gold AND country == ID) OR (tier == silver AND NOT beta == true)
+	rules := []model.Rule{
+		{Combinator: "AND", Rules: []model.Rule{
+			{Target: "query", Field: "tier", Operator: "equals", Value: "gold"},
+			{Target: "query", Field: "country", Operator: "equals", Value: "ID"},
+		}},
+		{Combinator: "AND", Rules: []model.Rule{
+			{Target: "query", Field: "tier", Operator: "equals", Value: "silver"},
+			{Target: "query", Field: "beta", Operator: "equals", Value: "true", Not: true},
+		}},
+	}
+
+	cases := []struct {
+		query    map[string]string
+		expected bool
+	}{
+		{map[string]string{"tier": "gold", "country": "ID"}, true},
+		{map[string]string{"tier": "gold", "country": "SG"}, false},
+		{map[string]string{"tier": "silver"}, true},
+		{map[string]string{"tier": "silver", "beta": "true"}, false},
+	}
+	for _, tc := range cases {
+		if got, _ := EvaluateRules(rules, "OR", RequestContext{Query: tc.query}); got != tc.expected {
+			t.Errorf("EvaluateRules(%v) = %v, expected %v", tc.query, got, tc.expected)
+		}
+	}
+
+	negatedGroup := []model.Rule{{Combinator: "OR", Not: true, Rules: rules}}
+	if matched, _ := EvaluateRules(negatedGroup, "AND", RequestContext{Query: map[string]string{"tier": "gold", "country": "ID"}}); matched {
+		t.Error("Expected negated group not to match")
+	}
+}
+
+func TestEvaluateRules_ClientIPCIDR(t *testing.T) {
+	rules := []model.Rule{{Target: "clientIp", Operator: "cidr", Value: "10.0.0.0/8, 192.168.1.7"}}
+
+	for ip, expected := range map[string]bool{
+		"10.20.30.40": true,
+		"192.168.1.7": true,
+		"192.168.1.8": false,
+		"not-an-ip":   false,
+	} {
+		if got, _ := EvaluateRules(rules, "AND", RequestContext{ClientIP: ip}); got != expected {
+			t.Errorf("cidr match for %s = %v, expected %v", ip, got, expected)
+		}
+	}
+}
+
+func TestApplyOperator(t *testing.T) {
+	now := time.Now().UTC()
+	cases := []struct {
+		operator, actual, expected string
+		raw                        interface{}
+		want                       bool
+	}{
+		{"in", "gold", "silver, gold", nil, true},
+		{"not_in", "gold", `["silver","bronze"]`, nil, true},
+		{"in_ci", "GOLD", "silver,gold", nil, true},
+		{"starts_with", "order-123", "order-", nil, true},
+		{"ends_with_ci", "report.PDF", ".pdf", nil, true},
+		{"not_contains", "hello", "bye", nil, true},
+		{"equals_ci", "Alice", "alice", nil, true},
+		{"gt", "abc", "10", nil, false},
+		{"gte", "10", "10", nil, true},
+		{"len_gt", "", "2", []interface{}{1, 2, 3}, true},
+		{"len_eq", "héllo", "5", nil, true},
+		{"before", now.Add(-2 * time.Hour).Format(time.RFC3339), "now-1h", nil, true},
+		{"after", "2020-01-01", "2019-12-31", nil, true},
+		{"semver_gte", "v1.10.0", "1.9.3", nil, true},
+		{"semver_lt", "1.0.0-alpha", "1.0.0", nil, true},
+		{"semver_gt", "1.0.0-beta.11", "1.0.0-beta.2", nil, true},
+	}
+	for _, tc := range cases {
+		got, err := applyOperator(tc.operator, tc.actual, tc.raw, tc.expected)
+		if err != nil {
+			t.Errorf("%s(%q, %q) returned error: %v", tc.operator, tc.actual, tc.expected, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("%s(%q, %q) = %v, expected %v", tc.operator, tc.actual, tc.expected, got, tc.want)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	invalid := [][]model.Rule{
+		{{Target: "body", Field: "a", Operator: "almost_equals", Value: "x"}},
+		{{Target: "body", Field: "a", Operator: "gt", Value: "ten"}},
+		{{Target: "body", Field: "a", Operator: "regex", Value: "("}},
+		{{Target: "body", Field: "a", Operator: "before", Value: "yesterday"}},
+		{{Target: "nowhere", Field: "a", Operator: "equals", Value: "x"}},
+		{{Combinator: "AND", Rules: []model.Rule{{Target: "query", Field: "a", Operator: "semver_gt", Value: "x.y"}}}},
+	}
+	for _, rules := range invalid {
+		if err := ValidateRules(rules); err == nil {
+			t.Errorf("Expected validation error for %+v", rules)
+		}
+	}
+
+	// At request time, invalid rules from configs loaded from disk do not match
+	if matched, err := EvaluateRules(invalid[0], "AND", RequestContext{}); matched || err == nil {
+		t.Errorf("Expected unknown operator not to match and to be reported, got %v (%v)", matched, err)
+	}
+	negated := []model.Rule{{Target: "body", Field: "a", Operator: "", Value: "x", Not: true}}
+	fallback := []model.Rule{negated[0], {Target: "query", Field: "a", Operator: "equals", Value: "1"}}
+	if matched, _ := EvaluateRules(negated, "AND", RequestContext{}); matched {
+		t.Error("Expected a negated invalid rule not to match")
+	}
+	if matched, _ := EvaluateRules(fallback, "OR", RequestContext{Query: map[string]string{"a": "1"}}); !matched {
+		t.Error("Expected the valid rule of an OR to still match")
+	}
+
+	valid := []model.Rule{{Target: "header", Field: "X-Version", Operator: "semver_gte", Value: "2.0.0"}}
+	if err := ValidateRules(valid); err != nil {
+		t.Errorf("Unexpected validation error: %v", err)
+	}
+
+	configs := []model.MockConfig{
+		{Name: "a", Responses: []model.ConditionalResponse{{Rules: invalid[0]}}},
+		{Name: "b", Responses: []model.ConditionalResponse{{Rules: valid}}},
+		{Name: "c", Responses: []model.ConditionalResponse{{Rules: invalid[4]}}},
+	}
+	if errs := ConfigErrors(configs); len(errs) != 2 || !strings.Contains(errs[1].Error(), "config #3 (c)") {
+		t.Errorf("Expected the problems of configs a and c, got %v", errs)
+	}
+}
+
+func TestEvaluateRules_Expression(t *testing.T) {
+	var data interface{}
+	_ = json.Unmarshal([]byte(`{"items":[{"sku":"A"},{"sku":"B"},{"sku":"C"},{"sku":"D"}]}`), &data)
+	ctx := RequestContext{
+		BodyData: data,
+		Headers:  map[string]string{"X-Tier": "gold"},
+		Query:    map[string]string{"debug": "1"},
+	}
+
+	rules := []model.Rule{{Target: "expression", Value: `size(body.items) > 3 && headers["x-tier"] == "gold" && request.query.debug == "1"`}}
+	if matched, err := EvaluateRules(rules, "AND", ctx); err != nil || !matched {
+		t.Errorf("Expected expression to match, got %v (%v)", matched, err)
+	}
+
+	rules = []model.Rule{{Target: "expression", Value: `body.items[0].sku == "B"`, Not: true}}
+	if matched, err := EvaluateRules(rules, "AND", ctx); err != nil || !matched {
+		t.Errorf("Expected negated expression to match, got %v (%v)", matched, err)
+	}
+
+	if err := ValidateRules([]model.Rule{{Target: "expression", Value: `size(body.items >`}}); err == nil {
+		t.Error("Expected compile error for invalid expression")
+	}
+
+	// state holds the resource collections
+	store := NewResourceStore()
+	store.List(CollectionKey{Mock: "/users", Path: "/users"}, model.ResourceConfig{Data: []interface{}{map[string]interface{}{"id": float64(1)}}}, nil)
+	ctx.State = store.State()
+	rules = []model.Rule{{Target: "expression", Value: `size(state["/users"]) == 1 && size(state["/orders"]) == 0`}}
+	if matched, err := EvaluateRules(rules, "AND", ctx); err != nil || !matched {
+		t.Errorf("Expected the state expression to match, got %v (%v)", matched, err)
+	}
+	if got := RenderTemplate(`{{len (index .state "/users")}}`, ctx); got != float64(1) {
+		t.Errorf("Expected templates to see the state, got %v", got)
+	}
+
+	// Requests without the fields an expression reads just do not match
+	for _, src := range []string{`body.user.name == 'a'`, `body.age > 18`} {
+		rules := []model.Rule{{Target: "expression", Value: src}}
+		if err := ValidateRules(rules); err != nil {
+			t.Errorf("Unexpected validation error for %s: %v", src, err)
+		}
+		if matched, err := EvaluateRules(rules, "AND", RequestContext{}); matched || err == nil {
+			t.Errorf("Expected %s not to match an empty body and to report why, got %v (%v)", src, matched, err)
+		}
+	}
+}
+
+func TestMatchesSchemaOperator(t *testing.T) {
+	schema := `{"type":"object","required":["name"],"properties":{"name":{"type":"string"},"age":{"type":"integer","minimum":0}}}`
+
+	var valid, invalid interface{}
+	_ = json.Unmarshal([]byte(`{"name":"alice","age":30}`), &valid)
+	_ = json.Unmarshal([]byte(`{"age":-1}`), &invalid)
+
+	rules := []model.Rule{{Target: "body", Field: "", Operator: "matches_schema", Value: schema}}
+	if matched, err := EvaluateRules(rules, "AND", RequestContext{BodyData: valid}); err != nil || !matched {
+		t.Errorf("Expected valid body to match schema, got %v (%v)", matched, err)
+	}
+	if matched, err := EvaluateRules(rules, "AND", RequestContext{BodyData: invalid}); err != nil || matched {
+		t.Errorf("Expected invalid body not to match schema, got %v (%v)", matched, err)
+	}
+
+	errs, err := ValidateJSONSchema(schema, invalid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected 2 validation errors, got %v", errs)
+	}
+
+	body := SchemaErrorBody(map[string]interface{}{"code": "INVALID", "errors": "{{errors}}"}, errs)
+	if list, ok := body["errors"].([]string); !ok || len(list) != 2 {
+		t.Errorf("Expected errors list in error body, got %v", body)
+	}
+
+	if err := ValidateRules([]model.Rule{{Target: "body", Operator: "matches_schema", Value: "missing-schema.json"}}); err == nil {
+		t.Error("Expected error for missing schema file")
+	}
+
+	// Edits to a schema file take effect without a restart
+	file := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(file, []byte(`{"type":"object","required":["name"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errs, _ := ValidateJSONSchema(file, valid); len(errs) != 0 {
+		t.Errorf("Expected the body to match, got %v", errs)
+	}
+	if err := os.WriteFile(file, []byte(`{"type":"object","required":["name","email"]}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if errs, _ := ValidateJSONSchema(file, valid); len(errs) != 1 {
+		t.Errorf("Expected the edited schema to require email, got %v", errs)
+	}
+}
+
+func TestRenderTemplate_TextTemplate(t *testing.T) {
+	ctx := RequestContext{
+		BodyData: map[string]interface{}{"user": map[string]interface{}{"name": "alice", "tags": []interface{}{"a", "b"}}},
+		Headers:  map[string]string{"X-Tier": "gold"},
+		Query:    map[string]string{"mode": "full"},
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`{{if eq .query.mode "full"}}full{{else}}short{{end}}`, "full"},
+		{`{{.query.limit | default "10"}}`, "10"},
+		{`{{range $i, $tag := .body.user.tags}}{{$i}}:{{$tag}} {{end}}`, "0:a 1:b "},
+		{`{{.body.user.name | upper}} / {{"hello world" | camelCase}} / {{"HelloWorld" | snakeCase}}`, "ALICE / helloWorld / hello_world"},
+		{`{{add 2 3}} {{mul 1.5 2}} {{div 7 2}}`, "5 3 3.5"},
+		{`{{"2024-03-01" | dateAdd "1d" | date "2006-01-02"}}`, "2024-03-02"},
+		{`{{.body.user | json}}`, `{"name":"alice","tags":["a","b"]}`},
+		{`{{"a b" | urlEncode}} {{"hi" | b64enc}} {{index .headers "x-tier"}}`, "a+b aGk= gold"},
+		{`Hi {{body.name}}, {{range seq 2}}*{{end}}`, "Hi Bob, **"},
+		{`{{not a template`, `{{not a template`},
+	}
+	for _, tt := range tests {
+		ctx := ctx
+		ctx.Body = map[string]string{"name": "Bob"}
+		if got := RenderTemplate(tt.template, ctx); got != tt.expected {
+			t.Errorf("RenderTemplate(%q) = %q, expected %q", tt.template, got, tt.expected)
+		}
+	}
+}
+
+func TestRenderTemplate_RequestValuesNotExecuted(t *testing.T) {
+	probe := `{{range seq 3}}X{{end}}{{.headers}}`
+	ctx := RequestContext{
+		Body:    map[string]string{"name": probe},
+		Headers: map[string]string{"X-Name": probe},
+	}
+
+	tests := []struct {
+		template string
+		expected string
+	}{
+		{`Hi {{body.name}}`, "Hi " + probe},
+		{`Hi {{header.X-Name}} {{add 1 2}}`, "Hi " + probe + " 3"},
+		{`{{not a template {{body.name}}`, "{{not a template " + probe},
+	}
+	for _, tt := range tests {
+		if got := RenderTemplate(tt.template, ctx); got != tt.expected {
+			t.Errorf("RenderTemplate(%q) = %q, expected %q", tt.template, got, tt.expected)
+		}
+	}
+
+	textTemplateCache.Range(func(key, _ interface{}) bool {
+		if strings.Contains(key.(string), "range seq 3") {
+			t.Errorf("Expected only config strings to be parsed, found %q", key)
+		}
+		return true
+	})
+
+	if got := len(seq(1e9)); got != maxRepeat {
+		t.Errorf("Expected seq to be capped at %d, got %d", maxRepeat, got)
+	}
+}
+
+func TestRenderTemplate_TypePreserving(t *testing.T) {
+	var body interface{}
+	_ = json.Unmarshal([]byte(`{"age":42,"active":true,"nickname":null,"user":{"name":"alice"},"tags":["a","b"]}`), &body)
+	ctx := RequestContext{BodyData: body, Query: map[string]string{"limit": "5"}}
+
+	data := map[string]interface{}{
+		"age":      "{{body.age}}",
+		"active":   "{{body.active}}",
+		"nickname": "{{body.nickname}}",
+		"user":     "{{body.user}}",
+		"tags":     "{{.body.tags}}",
+		"sum":      "{{add .query.limit 1}}",
+		"limit":    "{{query.limit}}",
+		"label":    "Age {{body.age}}",
+		"number":   "{{faker.number}}",
+		"boolean":  "{{faker.boolean}}",
+		"echo":     "{{body}}",
+	}
+	result := RenderTemplate(data, ctx).(map[string]interface{})
+
+	if result["age"] != float64(42) || result["active"] != true || result["nickname"] != nil {
+		t.Errorf("Expected typed scalars, got %v %v %v", result["age"], result["active"], result["nickname"])
+	}
+	if user, ok := result["user"].(map[string]interface{}); !ok || user["name"] != "alice" {
+		t.Errorf("Expected user object, got %v", result["user"])
+	}
+	if tags, ok := result["tags"].([]interface{}); !ok || len(tags) != 2 {
+		t.Errorf("Expected tags array, got %v", result["tags"])
+	}
+	if result["sum"] != float64(6) {
+		t.Errorf("Expected sum 6, got %#v", result["sum"])
+	}
+	if result["limit"] != "5" || result["label"] != "Age 42" {
+		t.Errorf("Expected strings, got %#v and %#v", result["limit"], result["label"])
+	}
+	if _, ok := result["number"].(int); !ok {
+		t.Errorf("Expected faker number, got %#v", result["number"])
+	}
+	if _, ok := result["boolean"].(bool); !ok {
+		t.Errorf("Expected faker boolean, got %#v", result["boolean"])
+	}
+	if _, ok := result["echo"].(map[string]interface{}); !ok {
+		t.Errorf("Expected whole body, got %#v", result["echo"])
+	}
+}
+
+func TestRenderTemplate_Repeat(t *testing.T) {
+	ctx := RequestContext{Query: map[string]string{"limit": "50"}}
+
+	data := map[string]interface{}{
+		"products": map[string]interface{}{
+			"$repeat":   map[string]interface{}{"query": "limit", "default": float64(10), "max": float64(100)},
+			"$template": map[string]interface{}{"id": "{{.index}}", "name": "Product {{add .index 1}} of {{.count}}", "sku": "{{faker.uuid}}"},
+		},
+		"tags":  []interface{}{"fixed", map[string]interface{}{"$repeat": float64(2), "$template": "tag-{{.index}}"}},
+		"range": map[string]interface{}{"$repeat": "2-4", "$template": "{{faker.word}}"},
+	}
+	result := RenderTemplate(data, ctx).(map[string]interface{})
+
+	products := result["products"].([]interface{})
+	if len(products) != 50 {
+		t.Fatalf("Expected 50 products, got %d", len(products))
+	}
+	last := products[49].(map[string]interface{})
+	if last["id"] != float64(49) || last["name"] != "Product 50 of 50" {
+		t.Errorf("Unexpected last product %v", last)
+	}
+	if products[0].(map[string]interface{})["sku"] == last["sku"] {
+		t.Error("Expected distinct faker values per element")
+	}
+
+	tags := result["tags"].([]interface{})
+	if len(tags) != 3 || tags[2] != "tag-1" {
+		t.Errorf("Expected expanded tags, got %v", tags)
+	}
+	if n := len(result["range"].([]interface{})); n < 2 || n > 4 {
+		t.Errorf("Expected 2-4 items, got %d", n)
+	}
+
+	ctx.Query = nil
+	result = RenderTemplate(data, ctx).(map[string]interface{})
+	if n := len(result["products"].([]interface{})); n != 10 {
+		t.Errorf("Expected default of 10 products, got %d", n)
+	}
+}
+
+func TestRenderTemplate_RepeatBudget(t *testing.T) {
+	nested := map[string]interface{}{
+		"$repeat": float64(maxRepeat),
+		"$template": map[string]interface{}{
+			"$repeat":   float64(maxRepeat),
+			"$template": "x",
+		},
+	}
+	outer := RenderTemplate(nested, RequestContext{}).([]interface{})
+
+	total := len(outer)
+	for _, inner := range outer {
+		total += len(inner.([]interface{}))
+	}
+	if total != maxRenderRepeat {
+		t.Errorf("Expected nested repeats to generate %d elements in all, got %d", maxRenderRepeat, total)
+	}
+}
+
+func TestFakerFunctions(t *testing.T) {
+	tests := []struct {
+		template string
+		check    func(v interface{}) bool
+	}{
+		{`{{faker.number 5 7}}`, func(v interface{}) bool { n, ok := v.(int); return ok && n >= 5 && n <= 7 }},
+		{`{{faker.regex "[A-Z]{3}-\d{4}"}}`, func(v interface{}) bool {
+			s, _ := v.(string)
+			return regexp.MustCompile(`^[A-Z]{3}-\d{4}$`).MatchString(s)
+		}},
+		{`{{faker.pick "a b" "c"}}`, func(v interface{}) bool { return v == "a b" || v == "c" }},
+		{`{{faker.date "2006-01-02" "-30d" "now"}}`, func(v interface{}) bool {
+			d, err := time.Parse("2006-01-02", v.(string))
+			return err == nil && d.After(time.Now().AddDate(0, 0, -32)) && !d.After(time.Now())
+		}},
+		{`{{faker.url}}`, func(v interface{}) bool { s, _ := v.(string); return strings.HasPrefix(s, "http") }},
+		{`{{faker.firstname}}`, func(v interface{}) bool { s, _ := v.(string); return s != "" }},
+		{`{{faker "number" 1 1}}`, func(v interface{}) bool { return v == float64(1) }},
+		{`{{faker.unknown_function}}`, func(v interface{}) bool { return v == "{{faker.unknown_function}}" }},
+		{`ID {{faker.number 3 3}}`, func(v interface{}) bool { return v == "ID 3" }},
+	}
+	for _, tt := range tests {
+		if got := RenderTemplate(tt.template, RequestContext{}); !tt.check(got) {
+			t.Errorf("RenderTemplate(%q) = %#v", tt.template, got)
+		}
+	}
+
+	names := map[string]bool{}
+	for _, fn := range FakerFunctions() {
+		names[fn.Name] = true
+	}
+	if !names["pick"] || !names["url"] || !names["beername"] {
+		t.Error("Expected built-in and gofakeit functions to be listed")
+	}
+}
+
+func TestResourceStore_CollectionsPerMock(t *testing.T) {
+	store := NewResourceStore()
+	cfg := model.ResourceConfig{Data: []interface{}{map[string]interface{}{"id": float64(1)}}}
+	for i := 0; i < maxCollections+50; i++ {
+		key := CollectionKey{Mock: "/users/:id/orders", Path: fmt.Sprintf("/users/%d/orders", i)}
+		store.List(key, cfg, nil)
+	}
+	store.List(CollectionKey{Mock: "/users", Path: "/users"}, cfg, nil)
+
+	data := store.Export()
+	if len(data) != maxCollections+1 {
+		t.Errorf("Expected %d collections, got %d", maxCollections+1, len(data))
+	}
+	if _, ok := data["/users/0/orders"]; ok {
+		t.Error("Expected the oldest collection to be dropped")
+	}
+	if n := store.ResetMock("/users/:id/orders"); n != maxCollections {
+		t.Errorf("Expected %d collections to be reset, got %d", maxCollections, n)
+	}
+	if _, ok := store.Export()["/users"]; !ok {
+		t.Error("Expected the collections of other mocks to be kept")
+	}
+}
+
+func TestApplyList(t *testing.T) {
+	var users []interface{}
+	for i, name := range []string{"Eve", "Bob", "Dan", "Alice", "Carol"} {
+		users = append(users, map[string]interface{}{
+			"id":     float64(i + 1),
+			"name":   name,
+			"age":    float64(20 + i*5),
+			"status": []string{"active", "inactive"}[i%2],
+		})
+	}
+	names := func(v interface{}) string {
+		var out []string
+		for _, item := range v.([]interface{}) {
+			out = append(out, item.(map[string]interface{})["name"].(string))
+		}
+		return strings.Join(out, ",")
+	}
+
+	body, headers := ApplyList(model.ListConfig{}, users, map[string]string{"offset": "1", "limit": "2", "sort": "name"}, "")
+	page := body.(map[string]interface{})
+	if got := names(page["data"]); got != "Bob,Carol" {
+		t.Errorf("Expected Bob,Carol, got %s", got)
+	}
+	if meta := page["meta"].(map[string]interface{}); meta["total"] != 5 || meta["offset"] != 1 || meta["limit"] != 2 {
+		t.Errorf("Unexpected offset meta: %v", meta)
+	}
+	if headers["X-Total-Count"] != "5" {
+		t.Errorf("Expected X-Total-Count 5, got %q", headers["X-Total-Count"])
+	}
+
+	body, _ = ApplyList(model.ListConfig{Style: "page", DefaultSize: 2}, users, map[string]string{"page": "2", "status": "active", "sort": "-age"}, "")
+	page = body.(map[string]interface{})
+	if got := names(page["data"]); got != "Eve" {
+		t.Errorf("Expected Eve on page 2 of active users, got %s", got)
+	}
+	if meta := page["meta"].(map[string]interface{}); meta["totalPages"] != 2 || meta["total"] != 3 {
+		t.Errorf("Unexpected page meta: %v", meta)
+	}
+
+	for _, query := range []map[string]string{
+		{"page": "1844674407370955162", "size": "10"},
+		{"page": "9223372036854775807"},
+	} {
+		body, _ = ApplyList(model.ListConfig{Style: "page"}, users, query, "")
+		if got := names(body.(map[string]interface{})["data"]); got != "" {
+			t.Errorf("Expected an empty page for %v, got %s", query, got)
+		}
+	}
+
+	body, _ = ApplyList(model.ListConfig{}, users, map[string]string{"age_gte": "25", "age_lte": "35", "name_ne": "Dan", "unrelated": "x"}, "")
+	if got := names(body.(map[string]interface{})["data"]); got != "Bob,Alice" {
+		t.Errorf("Expected Bob,Alice from the filters, got %s", got)
+	}
+
+	cursor := ""
+	var seen []string
+	for i := 0; i < 5; i++ {
+		body, _ = ApplyList(model.ListConfig{Style: "cursor"}, users, map[string]string{"limit": "2", "cursor": cursor}, "")
+		page = body.(map[string]interface{})
+		seen = append(seen, names(page["data"]))
+		meta := page["meta"].(map[string]interface{})
+		if meta["hasMore"] != true {
+			break
+		}
+		cursor = meta["nextCursor"].(string)
+	}
+	if got := strings.Join(seen, "|"); got != "Eve,Bob|Dan,Alice|Carol" {
+		t.Errorf("Unexpected cursor pages: %s", got)
+	}
+
+	body, headers = ApplyList(model.ListConfig{Style: "link", DefaultSize: 1}, users, map[string]string{"page": "2", "q": "L"}, "http://localhost/users")
+	if got := names(body); got != "Carol" {
+		t.Errorf("Expected the link style to keep an array body, got %s", got)
+	}
+	if link := headers["Link"]; !strings.Contains(link, `<http://localhost/users?page=1&q=L&size=1>; rel="prev"`) || strings.Contains(link, `rel="next"`) {
+		t.Errorf("Unexpected Link header: %s", link)
+	}
+}
@@ -0,0 +1,474 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+	"time"
+	"unicode"
+
+	"github.com/brianvoe/gofakeit/v6"
+)
+
+// templateFuncs is the helper library available to response templates, e.g.
+// {{.query.limit | default "10"}}, {{now | date "2006-01-02"}} or
+// {{range $i := seq 3}}...{{end}}
+var templateFuncs = template.FuncMap{
+	// Values
+	"default":  defaultValue,
+	"coalesce": coalesce,
+	"json":     toJSON,
+	"int":      toInt,
+	"float":    toFloat,
+	"string":   stringifyValue,
+	"seq":      seq,
+
+	// Dates
+	"now":     time.Now,
+	"date":    formatDate,
+	"dateAdd": dateAdd,
+	"unix":    unixTime,
+
+	// Math
+	"add": func(a, b interface{}) interface{} { return mathOp(a, b, func(x, y float64) float64 { return x + y }) },
+	"sub": func(a, b interface{}) interface{} { return mathOp(a, b, func(x, y float64) float64 { return x - y }) },
+	"mul": func(a, b interface{}) interface{} { return mathOp(a, b, func(x, y float64) float64 { return x * y }) },
+	"div": func(a, b interface{}) interface{} { return mathOp(a, b, func(x, y float64) float64 { return x / y }) },
+	"mod": func(a, b interface{}) interface{} { return mathOp(a, b, math.Mod) },
+	"min": func(a, b interface{}) interface{} { return mathOp(a, b, math.Min) },
+	"max": func(a, b interface{}) interface{} { return mathOp(a, b, math.Max) },
+
+	// Encoding
+	"b64enc":    func(s interface{}) string { return base64.StdEncoding.EncodeToString([]byte(stringifyValue(s))) },
+	"b64dec":    b64dec,
+	"urlEncode": func(s interface{}) string { return url.QueryEscape(stringifyValue(s)) },
+	"urlDecode": func(s interface{}) (string, error) { return url.QueryUnescape(stringifyValue(s)) },
+
+	// Strings
+	"upper":     func(s interface{}) string { return strings.ToUpper(stringifyValue(s)) },
+	"lower":     func(s interface{}) string { return strings.ToLower(stringifyValue(s)) },
+	"title":     func(s interface{}) string { return titleCase(stringifyValue(s)) },
+	"trim":      func(s interface{}) string { return strings.TrimSpace(stringifyValue(s)) },
+	"camelCase": func(s interface{}) string { return joinWords(stringifyValue(s), "camel") },
+	"snakeCase": func(s interface{}) string { return joinWords(stringifyValue(s), "_") },
+	"kebabCase": func(s interface{}) string { return joinWords(stringifyValue(s), "-") },
+	"replace": func(old, new string, s interface{}) string {
+		return strings.ReplaceAll(stringifyValue(s), old, new)
+	},
+	"contains":  func(sub string, s interface{}) bool { return strings.Contains(stringifyValue(s), sub) },
+	"hasPrefix": func(prefix string, s interface{}) bool { return strings.HasPrefix(stringifyValue(s), prefix) },
+	"hasSuffix": func(suffix string, s interface{}) bool { return strings.HasSuffix(stringifyValue(s), suffix) },
+	"split":     func(sep string, s interface{}) []string { return strings.Split(stringifyValue(s), sep) },
+	"join":      joinList,
+}
+
+// fakerFuncs are the template functions that draw from a faker, e.g.
+// {{faker "number" 1 100}} or {{uuid}}
+func fakerFuncs(f *gofakeit.Faker) template.FuncMap {
+	return template.FuncMap{
+		"faker": func(name string, args ...interface{}) (interface{}, error) {
+			strArgs := make([]string, len(args))
+			for i, arg := range args {
+				strArgs[i] = stringifyValue(arg)
+			}
+			return callFaker(f, name, strArgs)
+		},
+		"uuid": f.UUID,
+	}
+}
+
+// placeholderFunc is the template function that request and faker
+// placeholders such as {{body.user.name}} are rewritten to before a string is
+// parsed, so their values are resolved by the template and never parsed
+const placeholderFunc = "placeholder"
+
+// wrapPlaceholders rewrites request and faker placeholders into calls of the
+// placeholder function, so a string using them is a valid Go template
+func wrapPlaceholders(src string) string {
+	wrap := func(m string) string {
+		return "{{" + placeholderFunc + " " + strconv.Quote(m) + "}}"
+	}
+	src = templateRegex.ReplaceAllStringFunc(src, wrap)
+	return fakerRegex.ReplaceAllStringFunc(src, wrap)
+}
+
+// requestFuncs are the template functions bound to the request: the faker
+// functions use its seeded faker, seq draws from the repeat budget of the
+// render and placeholder resolves request values
+func requestFuncs(ctx RequestContext) template.FuncMap {
+	funcs := fakerFuncs(ctx.faker())
+	funcs["seq"] = func(n interface{}) []int {
+		count, _ := toInt(n)
+		if count > maxRepeat {
+			count = maxRepeat
+		}
+		return seq(ctx.takeRepeats(count))
+	}
+	funcs[placeholderFunc] = func(m string) string {
+		return resolvePlaceholder(m, ctx)
+	}
+	return funcs
+}
+
+// requestFuncStubs stand in for requestFuncs while parsing. Templates are
+// bound to the request before they run, so the stubs are never called.
+var requestFuncStubs = template.FuncMap{
+	"faker":         func(name string, args ...interface{}) (interface{}, error) { return nil, nil },
+	"uuid":          func() string { return "" },
+	"seq":           func(n interface{}) []int { return nil },
+	placeholderFunc: func(m string) string { return m },
+}
+
+// textTemplateCache holds parsed templates, and parse errors, by source.
+// Sources come from the config only, never from a request.
+var textTemplateCache sync.Map
+
+type parsedTemplate struct {
+	tmpl *template.Template
+	err  error
+}
+
+// renderTextTemplate runs a string from the config through text/template with
+// the request as data. It reports false for strings that are not valid
+// templates, or fail to execute, so literal braces survive.
+func renderTextTemplate(src string, ctx RequestContext) (string, bool) {
+	tmpl, err := parseTextTemplate(src)
+	if err != nil {
+		return "", false
+	}
+	var buf bytes.Buffer
+	if err := executeTemplate(tmpl, src, ctx, &buf); err != nil {
+		return "", false
+	}
+	return buf.String(), true
+}
+
+// renderTemplateValue evaluates a template made of a single action, such as
+// {{.body.user}} or {{add 1 2}}, and returns the resulting value instead of
+// its text. The action is piped through json and decoded again, so the value
+// takes its JSON type.
+func renderTemplateValue(src string, ctx RequestContext) (interface{}, bool) {
+	tmpl, err := parseTextTemplate(src)
+	if err != nil || len(tmpl.Tree.Root.Nodes) != 1 {
+		return nil, false
+	}
+	action, ok := tmpl.Tree.Root.Nodes[0].(*parse.ActionNode)
+	if !ok || len(action.Pipe.Decl) > 0 {
+		return nil, false
+	}
+
+	captureSrc := "{{" + action.Pipe.String() + " | json}}"
+	capture, err := parseTextTemplate(captureSrc)
+	if err != nil {
+		return nil, false
+	}
+	var buf bytes.Buffer
+	if err := executeTemplate(capture, captureSrc, ctx, &buf); err != nil {
+		return nil, false
+	}
+	var value interface{}
+	if err := json.Unmarshal(buf.Bytes(), &value); err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// parseTextTemplate parses a template from the config once and caches it.
+// Request values must never be part of src.
+func parseTextTemplate(src string) (*template.Template, error) {
+	if v, ok := textTemplateCache.Load(src); ok {
+		parsed := v.(parsedTemplate)
+		return parsed.tmpl, parsed.err
+	}
+	tmpl, err := template.New("response").Funcs(templateFuncs).Funcs(requestFuncStubs).Parse(src)
+	textTemplateCache.Store(src, parsedTemplate{tmpl, err})
+	return tmpl, err
+}
+
+// executeTemplate runs a cached template with the functions and data of the
+// request
+func executeTemplate(tmpl *template.Template, src string, ctx RequestContext, w io.Writer) error {
+	bound, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+	return bound.Funcs(requestFuncs(ctx)).Execute(w, templateData(ctx, src))
+}
+
+// requestData exposes the request to templates with the same names as in
+// expression rules: .body, .headers (lowercased), .query, .path, .cookies,
+// .form, .method, .host, ... and an empty .state
+func requestData(ctx RequestContext) map[string]interface{} {
+	env := newExpressionEnv(ctx)
+	data := make(map[string]interface{}, len(env.Request)+1)
+	for k, v := range env.Request {
+		data[k] = v
+	}
+	data["state"] = env.State
+	return data
+}
+
+// templateData is the data a template runs with: the request values read at
+// the start of the render, the template variables and, for templates that
+// mention it, the state
+func templateData(ctx RequestContext, src string) map[string]interface{} {
+	request := ctx.data
+	if request == nil {
+		request = requestData(ctx)
+	}
+	withState := ctx.State != nil && strings.Contains(src, "state")
+	if len(ctx.Vars) == 0 && !withState {
+		return request
+	}
+	data := make(map[string]interface{}, len(request)+len(ctx.Vars))
+	for k, v := range request {
+		data[k] = v
+	}
+	if withState {
+		data["state"] = ctx.State()
+	}
+	for k, v := range ctx.Vars {
+		data[k] = v
+	}
+	return data
+}
+
+// isEmpty reports whether a template value counts as missing for default
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// defaultValue returns def when val is missing or empty
+func defaultValue(def interface{}, val ...interface{}) interface{} {
+	if len(val) == 0 || isEmpty(val[0]) {
+		return def
+	}
+	return val[0]
+}
+
+// coalesce returns the first non-empty value
+func coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !isEmpty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+func toJSON(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func toFloat(v interface{}) (float64, error) {
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case float32:
+		return float64(n), nil
+	case int:
+		return float64(n), nil
+	case int64:
+		return float64(n), nil
+	case bool:
+		if n {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(strings.TrimSpace(stringifyValue(v)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a number", stringifyValue(v))
+	}
+	return f, nil
+}
+
+func toInt(v interface{}) (int, error) {
+	f, err := toFloat(v)
+	if err != nil {
+		return 0, err
+	}
+	return int(f), nil
+}
+
+// mathOp applies op to two numbers and returns an integer when the result
+// is whole, so {{add 1 2}} renders "3" rather than "3.000000"
+func mathOp(a, b interface{}, op func(x, y float64) float64) interface{} {
+	x, errA := toFloat(a)
+	y, errB := toFloat(b)
+	if errA != nil || errB != nil {
+		return nil
+	}
+	result := op(x, y)
+	if result == math.Trunc(result) && math.Abs(result) < 1<<53 {
+		return int64(result)
+	}
+	return result
+}
+
+// seq returns 0..n-1 for ranging a fixed number of times, up to maxRepeat
+func seq(n interface{}) []int {
+	count, _ := toInt(n)
+	if count < 0 {
+		count = 0
+	}
+	if count > maxRepeat {
+		count = maxRepeat
+	}
+	items := make([]int, count)
+	for i := range items {
+		items[i] = i
+	}
+	return items
+}
+
+// toTime converts a time, an ISO date, a relative time like "now-1d" or a
+// unix timestamp into a time
+func toTime(v interface{}) (time.Time, error) {
+	switch t := v.(type) {
+	case time.Time:
+		return t, nil
+	case float64:
+		return time.Unix(int64(t), 0), nil
+	case int:
+		return time.Unix(int64(t), 0), nil
+	case int64:
+		return time.Unix(t, 0), nil
+	}
+	return parseTimeValue(stringifyValue(v), time.Now())
+}
+
+// formatDate formats a time with a Go layout, e.g. {{now | date "2006-01-02"}}
+func formatDate(layout string, v interface{}) (string, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return "", err
+	}
+	return t.Format(layout), nil
+}
+
+// dateAdd shifts a time by a duration such as "90m", "-24h" or "7d"
+func dateAdd(duration string, v interface{}) (time.Time, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return time.Time{}, err
+	}
+	shifted, err := parseTimeValue("now"+signed(duration), t)
+	if err != nil {
+		d, derr := time.ParseDuration(duration)
+		if derr != nil {
+			return time.Time{}, err
+		}
+		return t.Add(d), nil
+	}
+	return shifted, nil
+}
+
+// signed prefixes a duration with "+" unless it already has a sign
+func signed(duration string) string {
+	duration = strings.TrimSpace(duration)
+	if strings.HasPrefix(duration, "-") || strings.HasPrefix(duration, "+") {
+		return duration
+	}
+	return "+" + duration
+}
+
+func unixTime(v interface{}) (int64, error) {
+	t, err := toTime(v)
+	if err != nil {
+		return 0, err
+	}
+	return t.Unix(), nil
+}
+
+func b64dec(s interface{}) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(stringifyValue(s))
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+func joinList(sep string, list interface{}) string {
+	rv := reflect.ValueOf(list)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return stringifyValue(list)
+	}
+	parts := make([]string, rv.Len())
+	for i := range parts {
+		parts[i] = stringifyValue(rv.Index(i).Interface())
+	}
+	return strings.Join(parts, sep)
+}
+
+// splitWords breaks "helloWorld", "hello_world" or "Hello world" into words
+func splitWords(s string) []string {
+	var words []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, strings.ToLower(string(current)))
+			current = current[:0]
+		}
+	}
+	runes := []rune(s)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			current = append(current, r)
+		default:
+			current = append(current, r)
+		}
+	}
+	flush()
+	return words
+}
+
+func titleCase(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToUpper(r)
+		}
+	}
+	return string(runes)
+}
+
+// joinWords joins the words of s with sep, or in camelCase for "camel"
+func joinWords(s, sep string) string {
+	words := splitWords(s)
+	if sep != "camel" {
+		return strings.Join(words, sep)
+	}
+	for i := 1; i < len(words); i++ {
+		words[i] = titleCase(words[i])
+	}
+	return strings.Join(words, "")
+}